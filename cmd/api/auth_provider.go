@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"testbook-backend/internal/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newAuthenticator picks the auth backend from the environment. AUTH_PROVIDER
+// may be "clerk" or "local"; when unset, Clerk is used if CLERK_SECRET_KEY is
+// present and self-issued JWTs otherwise. Returns nil if nothing is configured.
+func newAuthenticator() (auth.Authenticator, error) {
+	provider := os.Getenv("AUTH_PROVIDER")
+	if provider == "" {
+		provider = "local"
+		if os.Getenv("CLERK_SECRET_KEY") != "" {
+			provider = "clerk"
+		}
+	}
+
+	switch provider {
+	case "clerk":
+		key := os.Getenv("CLERK_SECRET_KEY")
+		if key == "" {
+			return nil, errors.New("AUTH_PROVIDER=clerk needs CLERK_SECRET_KEY")
+		}
+		return auth.NewClerkAuthenticator(key), nil
+
+	case "local":
+		cfg, err := localAuthConfig()
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			return nil, nil
+		}
+		return auth.NewLocalAuthenticator(*cfg)
+
+	default:
+		return nil, fmt.Errorf("unknown AUTH_PROVIDER %q", provider)
+	}
+}
+
+// localAuthConfig reads the self-issued JWT settings: AUTH_JWT_SECRET for
+// HS256, or AUTH_JWT_PUBLIC_KEY_FILE / AUTH_JWT_PRIVATE_KEY_FILE (PEM) for
+// RS256. Returns nil if none are set.
+func localAuthConfig() (*auth.LocalConfig, error) {
+	cfg := &auth.LocalConfig{Issuer: os.Getenv("AUTH_JWT_ISSUER")}
+
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		cfg.Secret = []byte(secret)
+		return cfg, nil
+	}
+
+	if path := os.Getenv("AUTH_JWT_PUBLIC_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("AUTH_JWT_PUBLIC_KEY_FILE: %w", err)
+		}
+	}
+	if path := os.Getenv("AUTH_JWT_PRIVATE_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("AUTH_JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+	}
+
+	if cfg.PublicKey == nil && cfg.PrivateKey == nil {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// runTokenCommand implements the `token` subcommand, which mints a
+// self-issued JWT for local development:
+//
+//	main token -email dev@example.com -username dev
+func runTokenCommand(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	email := fs.String("email", "", "email address of the user (required)")
+	username := fs.String("username", "", "username of the user")
+	subject := fs.String("subject", "", `token subject (default "local|<email>")`)
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid for")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	if *subject == "" {
+		*subject = "local|" + *email
+	}
+
+	cfg, err := localAuthConfig()
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return errors.New("set AUTH_JWT_SECRET or AUTH_JWT_PRIVATE_KEY_FILE to mint tokens")
+	}
+	authenticator, err := auth.NewLocalAuthenticator(*cfg)
+	if err != nil {
+		return err
+	}
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  *subject,
+		Email:    *email,
+		Username: *username,
+	}, *ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
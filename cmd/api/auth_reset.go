@@ -4,10 +4,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
 )
 
 func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
@@ -16,7 +20,7 @@ func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Bad request"))
 		return
 	}
 
@@ -31,7 +35,7 @@ func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Req
 	// Generate token
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	token := hex.EncodeToString(b)
@@ -39,7 +43,7 @@ func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Req
 	// Save token (valid for 1 hour)
 	expiry := time.Now().Add(1 * time.Hour)
 	if err := app.userStore.SaveResetToken(token, user.ID, expiry); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -57,31 +61,35 @@ func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Bad request"))
 		return
 	}
 
 	userID, expiry, err := app.userStore.GetResetToken(input.Token)
+	if errors.Is(err, store.ErrResetTokenNotFound) {
+		writeError(w, apperr.BadRequest("Invalid or expired token"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
 	if time.Now().After(expiry) {
 		app.userStore.DeleteResetToken(input.Token)
-		http.Error(w, "Token expired", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Token expired"))
 		return
 	}
 
 	// Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	if err := app.userStore.UpdatePassword(userID, string(hashedPassword)); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
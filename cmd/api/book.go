@@ -4,79 +4,118 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/catalog"
 	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
 )
 
 
 
-func (app *application) bookIDHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		app.getBookHandler(w, r)
-	case http.MethodPut:
-		app.updateBookHandler(w, r)
-	case http.MethodDelete:
-		app.deleteBookHandler(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := bookFilterParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result, err := app.bookStore.Search(filter)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
+	app.redactOwners(r, result.Results)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
-func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request) {
+// bookFilterParams reads the search, filter, sort and page parameters of a
+// book list.
+func bookFilterParams(r *http.Request) (store.BookFilter, error) {
 	query := r.URL.Query().Get("q")
 	genre := r.URL.Query().Get("genre")
+	location := r.URL.Query().Get("location")
+	availability := store.Availability(r.URL.Query().Get("availability"))
 	sortParam := r.URL.Query().Get("sort")
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-
-	if limit == 0 {
-		limit = 9 // Default limit
+	condition := store.Condition(r.URL.Query().Get("condition"))
+	language := strings.ToLower(r.URL.Query().Get("language"))
+	format := store.Format(r.URL.Query().Get("format"))
+
+	var isbn string
+	if s := r.URL.Query().Get("isbn"); s != "" {
+		var err error
+		if isbn, err = catalog.ParseISBN(s); err != nil {
+			return store.BookFilter{}, err
+		}
 	}
 
-	filter := store.BookFilter{
-		Query:  query,
-		Genre:  genre,
-		Sort:   sortParam,
-		Limit:  limit,
-		Offset: offset,
+	page, err := pageParams(r)
+	if err != nil {
+		return store.BookFilter{}, err
 	}
 
-	books, err := app.bookStore.GetAll(filter)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	if availability != "" && availability != store.AvailabilityAny && !availability.Valid() {
+		return store.BookFilter{}, apperr.BadRequest("Invalid availability")
+	}
+	if condition != "" && !condition.Valid() {
+		return store.BookFilter{}, apperr.BadRequest("Invalid condition")
+	}
+	if format != "" && !format.Valid() {
+		return store.BookFilter{}, apperr.BadRequest("Invalid format")
 	}
 
-	// Privacy: Redact details for unauthenticated users
-	// Privacy: Redact details for unauthenticated users
-	userID, _ := app.getAuthenticatedUserID(r)
-	isAuthenticated := userID != 0
+	return store.BookFilter{
+		Query:        query,
+		Genre:        genre,
+		Location:     location,
+		ISBN:         isbn,
+		Condition:    condition,
+		Language:     language,
+		Format:       format,
+		Availability: availability,
+		Sort:         sortParam,
+		Page:         page,
+	}, nil
+}
 
-	if !isAuthenticated {
-		for i := range books {
-			books[i].UserEmail = ""
-			books[i].UserUsername = ""
-			books[i].UserAvatarPath = ""
-		}
+// redactOwners hides who owns books from visitors who aren't signed in, and
+// owners' email addresses from everyone but the owners themselves.
+func (app *application) redactOwners(r *http.Request, books []store.Book) {
+	userID, _ := app.getAuthenticatedUserID(r)
+	for i := range books {
+		redactOwner(userID, &books[i])
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(books)
+// redactOwner is redactOwners for one book, as seen by userID, which is zero
+// for visitors.
+func redactOwner(userID int, book *store.Book) {
+	if book.UserID != userID {
+		book.UserEmail = ""
+	}
+	if userID == 0 {
+		book.UserUsername = ""
+		book.UserAvatarPath = ""
+		book.UserLocation = ""
+	}
 }
 
 func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title       string `json:"title"`
-		Author      string `json:"author"`
-		Description string `json:"description"`
-		Genre       string `json:"genre"`
-		ImagePath   string `json:"image_path"`
+	var input bookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
 	}
+	input.trim()
+	app.fillBookFromCatalog(r.Context(), &input)
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	v := validate.New()
+	app.validateBook(v, input.patch())
+	if err := v.Err(); err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -93,6 +132,12 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		Description: input.Description,
 		Genre:       input.Genre,
 		ImagePath:   input.ImagePath,
+		ISBN13:      input.ISBN,
+		ISBN10:      catalog.ISBN10(input.ISBN),
+		Condition:   store.Condition(input.Condition),
+		Language:    input.Language,
+		Format:      store.Format(input.Format),
+		PageCount:   input.PageCount,
 		UserID:      userID,
 		// Populate display fields for immediate frontend feedback
 		UserUsername:   user.Username,
@@ -102,7 +147,7 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 
 	createdBook, err := app.bookStore.Add(book)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -117,29 +162,27 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) getBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Path[len("/books/"):])
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Invalid ID"))
 		return
 	}
 
 	book, err := app.bookStore.GetByID(id)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, book.Version)
 	w.Header().Set("Content-Type", "application/json")
 
 	// Privacy: Redact details for unauthenticated users
 	userID, err := app.getAuthenticatedUserID(r)
 	isAuthenticated := userID != 0
 
-	if !isAuthenticated {
-		book.UserEmail = ""
-		book.UserUsername = ""
-		book.UserAvatarPath = ""
-	} else {
+	redactOwner(userID, &book)
+	if isAuthenticated {
 		hasRequested, err := app.requestStore.HasRequested(userID, book.ID)
 		if err == nil {
 			book.IsRequested = hasRequested
@@ -152,9 +195,15 @@ func (app *application) getBookHandler(w http.ResponseWriter, r *http.Request) {
 func (app *application) userBooksHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 
-	books, err := app.bookStore.GetByUserID(userID)
+	page, err := pageParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books, err := app.bookStore.GetByUserID(userID, page)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -163,77 +212,211 @@ func (app *application) userBooksHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Path[len("/books/"):])
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Invalid ID"))
 		return
 	}
 
 	existingBook, err := app.bookStore.GetByID(id)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		writeError(w, err)
 		return
 	}
 
 	userID := r.Context().Value("userID").(int)
 	if existingBook.UserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		writeError(w, apperr.Forbidden("Forbidden"))
 		return
 	}
 
 	var input struct {
-		Title       string `json:"title"`
-		Author      string `json:"author"`
-		Description string `json:"description"`
-		Genre       string `json:"genre"`
-		ImagePath   string `json:"image_path"`
+		bookInput
+		Availability store.Availability `json:"availability"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Bad request"))
 		return
 	}
+	input.trim()
+
+	patch := input.patch()
+	if input.Availability != "" {
+		patch.Availability = &input.Availability
+	}
+	keepUnchanged(&patch, existingBook)
+
+	v := validate.New()
+	app.validateBook(v, patch)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := app.checkSwap(existingBook, patch); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	availability := existingBook.Availability
+	if input.Availability != "" {
+		availability = input.Availability
+	}
 
 	book := store.Book{
-		ID:          id,
-		Title:       input.Title,
-		Author:      input.Author,
-		Description: input.Description,
-		Genre:       input.Genre,
-		ImagePath:   input.ImagePath,
-		UserID:      userID,
+		ID:           id,
+		Title:        input.Title,
+		Author:       input.Author,
+		Description:  input.Description,
+		Genre:        input.Genre,
+		ImagePath:    input.ImagePath,
+		ISBN13:       input.ISBN,
+		ISBN10:       catalog.ISBN10(input.ISBN),
+		Condition:    store.Condition(input.Condition),
+		Language:     input.Language,
+		Format:       store.Format(input.Format),
+		PageCount:    input.PageCount,
+		Availability: availability,
+		UserID:       userID,
 	}
 
 	if err := app.bookStore.Update(book); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// patchBookHandler applies a JSON merge patch to a book, changing only the
+// fields it names. An If-Match header makes it conditional on the book's
+// version.
+func (app *application) patchBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	existingBook, err := app.bookStore.GetByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	if existingBook.UserID != userID {
+		writeError(w, apperr.Forbidden("Forbidden"))
+		return
+	}
+
+	doc, err := decodeMergePatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	v := validate.New()
+	doc.onlyFields(v, "title", "author", "description", "genre", "image_path", "isbn", "condition", "language", "format", "page_count", "availability")
+	patch := store.BookPatch{
+		Title:       doc.string(v, "title"),
+		Author:      doc.string(v, "author"),
+		Description: doc.string(v, "description"),
+		Genre:       doc.string(v, "genre"),
+		ImagePath:   doc.string(v, "image_path"),
+		Language:    doc.string(v, "language"),
+		PageCount:   doc.int(v, "page_count"),
+	}
+	if patch.Language != nil {
+		*patch.Language = strings.ToLower(*patch.Language)
+	}
+	if c := doc.string(v, "condition"); c != nil {
+		condition := store.Condition(*c)
+		patch.Condition = &condition
+	}
+	if f := doc.string(v, "format"); f != nil {
+		format := store.Format(*f)
+		patch.Format = &format
+	}
+	if isbn := doc.string(v, "isbn"); isbn != nil {
+		*isbn = normalizeISBN(*isbn)
+		patch.ISBN = isbn
+	}
+	if a := doc.string(v, "availability"); a != nil {
+		availability := store.Availability(*a)
+		patch.Availability = &availability
+	}
+	keepUnchanged(&patch, existingBook)
+	app.validateBook(v, patch)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := app.checkSwap(existingBook, patch); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	book, err := app.bookStore.Patch(id, patch, version)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, book.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(book)
 }
 
+// checkSwap returns store.ErrBookReserved if p changes the availability of
+// book while one of its requests is accepted, since until that swap ends
+// only it moves the book.
+func (app *application) checkSwap(book store.Book, p store.BookPatch) error {
+	if p.Availability == nil {
+		return nil
+	}
+	accepted, err := app.requestStore.GetIncomingRequests(book.UserID, store.IncomingRequestFilter{
+		BookID: book.ID,
+		Status: store.RequestAccepted,
+		Page:   store.Page{Limit: 1},
+	})
+	if err != nil {
+		return err
+	}
+	if accepted.Total > 0 {
+		return store.ErrBookReserved
+	}
+	return nil
+}
+
 func (app *application) deleteBookHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Path[len("/books/"):])
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Invalid ID"))
 		return
 	}
 
 	existingBook, err := app.bookStore.GetByID(id)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		writeError(w, err)
 		return
 	}
 
 	userID := r.Context().Value("userID").(int)
 	if existingBook.UserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		writeError(w, apperr.Forbidden("Forbidden"))
 		return
 	}
 
 	if err := app.bookStore.Delete(id); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -243,7 +426,7 @@ func (app *application) deleteBookHandler(w http.ResponseWriter, r *http.Request
 func (app *application) listPopularGenresHandler(w http.ResponseWriter, r *http.Request) {
 	genres, err := app.bookStore.GetPopularGenres()
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"testbook-backend/internal/catalog"
+	"testbook-backend/internal/store"
+)
+
+// lookupISBNHandler previews what a book listed by ISBN would be filled in
+// with, so the form can show it before the book is created.
+func (app *application) lookupISBNHandler(w http.ResponseWriter, r *http.Request) {
+	isbn, err := catalog.ParseISBN(r.URL.Query().Get("isbn"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	input := bookInput{ISBN: isbn}
+	if err := app.fillFromCatalog(r.Context(), &input); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(input)
+}
+
+// fillFromCatalog looks up in.ISBN and fills in whichever of title, author,
+// description, genre, page count, language and cover the user left blank.
+// The caller must have checked the ISBN.
+func (app *application) fillFromCatalog(ctx context.Context, in *bookInput) error {
+	if app.bookMetadata == nil {
+		return catalog.ErrNotFound
+	}
+	m, err := app.bookMetadata.Lookup(ctx, in.ISBN)
+	if err != nil {
+		return err
+	}
+
+	fill := func(dst *string, value string, max int) {
+		if *dst == "" {
+			*dst = truncate(strings.TrimSpace(value), max)
+		}
+	}
+	fill(&in.Title, m.Title, maxTitleLength)
+	fill(&in.Author, m.Author, maxAuthorLength)
+	fill(&in.Description, m.Description, maxDescriptionLength)
+	fill(&in.Genre, matchGenre(m.Subjects), 0)
+	if in.PageCount == 0 && m.PageCount <= maxPageCount {
+		in.PageCount = m.PageCount
+	}
+	if in.Language == "" && languagePattern.MatchString(m.Language) {
+		in.Language = m.Language
+	}
+	if in.ImagePath == "" && catalog.IsCoverURL(m.CoverURL) {
+		in.ImagePath = m.CoverURL
+	}
+	return nil
+}
+
+// fillBookFromCatalog is fillFromCatalog for creating a book: a catalogue
+// that is down or doesn't know the ISBN isn't an error, the user just has to
+// fill the details in themselves.
+func (app *application) fillBookFromCatalog(ctx context.Context, in *bookInput) {
+	if in.ISBN == "" {
+		return
+	}
+	if _, err := catalog.ParseISBN(in.ISBN); err != nil {
+		return
+	}
+	if err := app.fillFromCatalog(ctx, in); err != nil && !errors.Is(err, catalog.ErrNotFound) {
+		log.Printf("Failed to look up ISBN %s: %v", in.ISBN, err)
+	}
+}
+
+// matchGenre picks the first of a catalogue's subjects that names one of our
+// genres, e.g. "Fantasy fiction" files under Fantasy. Longer genre names are
+// tried first so "Science fiction" isn't taken as Science.
+func matchGenre(subjects []string) string {
+	var best string
+	for _, subject := range subjects {
+		words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(subject), func(r rune) bool {
+			return r == ' ' || r == ',' || r == '/' || r == '(' || r == ')'
+		}), " ") + " "
+		for _, genre := range store.Genres {
+			if strings.Contains(words, " "+strings.ToLower(genre)+" ") && len(genre) > len(best) {
+				best = genre
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to at most max runes; max 0 means no limit.
+func truncate(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+	if r := []rune(s); len(r) > max {
+		return strings.TrimSpace(string(r[:max]))
+	}
+	return s
+}
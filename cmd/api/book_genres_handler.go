@@ -8,7 +8,7 @@ import (
 func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
 	genres, err := app.bookStore.GetGenres()
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
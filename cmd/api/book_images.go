@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
+)
+
+// ownBook returns the book named by the request path if the signed-in user
+// owns it.
+func (app *application) ownBook(r *http.Request) (store.Book, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return store.Book{}, apperr.BadRequest("Invalid ID")
+	}
+	book, err := app.bookStore.GetByID(id)
+	if err != nil {
+		return store.Book{}, err
+	}
+	if book.UserID != r.Context().Value("userID").(int) {
+		return store.Book{}, apperr.Forbidden("Forbidden")
+	}
+	return book, nil
+}
+
+// addBookImageHandler attaches an uploaded image to a book's gallery, at the
+// end. With "cover": true it also becomes the cover.
+func (app *application) addBookImageHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := app.ownBook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var input struct {
+		Path  string `json:"path"`
+		Cover bool   `json:"cover"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+	input.Path = strings.TrimSpace(input.Path)
+
+	v := validate.New()
+	v.Required("path", input.Path)
+	app.validateStoragePath(v, "path", input.Path)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	image, err := app.bookStore.AddImage(book.ID, input.Path, input.Cover)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+// reorderBookImagesHandler sets the order of a book's gallery from a list of
+// all its image IDs.
+func (app *application) reorderBookImagesHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := app.ownBook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var input struct {
+		ImageIDs []int `json:"image_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	images, err := app.bookStore.ReorderImages(book.ID, input.ImageIDs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+func (app *application) setBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := app.ownBook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	imageID, err := strconv.Atoi(r.PathValue("imageID"))
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid image ID"))
+		return
+	}
+
+	images, err := app.bookStore.SetCoverImage(book.ID, imageID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+func (app *application) removeBookImageHandler(w http.ResponseWriter, r *http.Request) {
+	book, err := app.ownBook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	imageID, err := strconv.Atoi(r.PathValue("imageID"))
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid image ID"))
+		return
+	}
+
+	if err := app.bookStore.RemoveImage(book.ID, imageID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
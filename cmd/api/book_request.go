@@ -2,49 +2,55 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
+
+	"testbook-backend/internal/apperr"
 	"testbook-backend/internal/store"
 )
 
 func (app *application) requestBookHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract book ID from URL /books/{id}/request
-	pathParts := strings.Split(r.URL.Path, "/")
-	// Expected path: /books/{id}/request
-	// Split: ["", "books", "{id}", "request"]
-	if len(pathParts) < 4 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	}
-	idStr := pathParts[2]
-	id, err := strconv.Atoi(idStr)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Invalid ID"))
 		return
 	}
 
 	book, err := app.bookStore.GetByID(id)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		writeError(w, err)
 		return
 	}
 
 	userID := r.Context().Value("userID").(int)
 	if book.UserID == userID {
-		http.Error(w, "Cannot request your own book", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Cannot request your own book"))
+		return
+	}
+
+	if book.Availability != store.AvailabilityAvailable {
+		writeError(w, apperr.Conflict("Book is not available"))
+		return
+	}
+
+	// Check before emailing the owner, so a repeated request doesn't notify
+	// them again
+	if err := app.requestStore.CheckRequest(userID, book.ID); err != nil {
+		writeError(w, err)
 		return
 	}
 
 	requester, err := app.userStore.GetByID(userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusInternalServerError)
+		writeError(w, apperr.Internal("User not found").Wrap(err))
 		return
 	}
 
 	owner, err := app.userStore.GetByID(book.UserID)
 	if err != nil {
-		http.Error(w, "Owner not found", http.StatusInternalServerError)
+		writeError(w, apperr.Internal("Owner not found").Wrap(err))
 		return
 	}
 
@@ -53,8 +59,14 @@ func (app *application) requestBookHandler(w http.ResponseWriter, r *http.Reques
 	if ownerName == "" {
 		ownerName = "there"
 	}
-	if err := app.emailService.SendRequestNotification(owner.Email, ownerName, book.Title, requester.Email); err != nil {
-		http.Error(w, "Failed to send email notification", http.StatusInternalServerError)
+	// Members coordinate through in-app messages, so the requester's email
+	// address is never shared with the owner.
+	requesterName := requester.Username
+	if requesterName == "" {
+		requesterName = "a ShelfSwap member"
+	}
+	if err := app.emailService.SendRequestNotification(owner.Email, ownerName, book.Title, requesterName); err != nil {
+		writeError(w, apperr.Internal("Failed to send email notification").Wrap(err))
 		return
 	}
 
@@ -64,7 +76,7 @@ func (app *application) requestBookHandler(w http.ResponseWriter, r *http.Reques
 		RequesterID: requester.ID,
 	}
 	if err := app.requestStore.AddRequest(req); err != nil {
-		http.Error(w, "Failed to save request", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -80,9 +92,20 @@ func (app *application) listTopRequestedBooksHandler(w http.ResponseWriter, r *h
 		}
 	}
 
-	books, err := app.requestStore.GetTopRequestedBooks(limit)
+	// ?days=7 ranks by recent requests, for what's trending
+	var since time.Time
+	if d := r.URL.Query().Get("days"); d != "" {
+		days, err := strconv.Atoi(d)
+		if err != nil || days <= 0 {
+			writeError(w, apperr.BadRequest("Invalid days"))
+			return
+		}
+		since = time.Now().AddDate(0, 0, -days)
+	}
+
+	books, err := app.requestStore.GetTopRequestedBooks(limit, since)
 	if err != nil {
-		http.Error(w, "Failed to fetch top requested books", http.StatusInternalServerError)
+		writeError(w, apperr.Internal("Failed to fetch top requested books").Wrap(err))
 		return
 	}
 
@@ -90,26 +113,62 @@ func (app *application) listTopRequestedBooksHandler(w http.ResponseWriter, r *h
 	json.NewEncoder(w).Encode(books)
 }
 
-func (app *application) deleteBookRequestHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract book ID from URL /books/{id}/request
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+func (app *application) withdrawBookRequestHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
 		return
 	}
-	idStr := pathParts[2]
-	bookID, err := strconv.Atoi(idStr)
+
+	userID := r.Context().Value("userID").(int)
+
+	// Withdrawing cancels the request rather than deleting it, so the owner
+	// keeps its history and an accepted swap frees the book again
+	req, err := app.requestStore.GetActiveRequest(userID, bookID)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	if _, err := app.requestStore.UpdateRequestStatus(req.ID, store.RequestCancelled); err != nil {
+		if errors.Is(err, store.ErrInvalidTransition) {
+			writeError(w, apperr.Conflict("Request is no longer active"))
+			return
+		}
+		writeError(w, apperr.Internal("Failed to withdraw request").Wrap(err))
 		return
 	}
 
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) incomingRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 
-	if err := app.requestStore.DeleteRequest(userID, bookID); err != nil {
-		http.Error(w, "Failed to delete request", http.StatusInternalServerError)
+	page, err := pageParams(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	filter := store.IncomingRequestFilter{
+		Status: store.RequestStatus(r.URL.Query().Get("status")),
+		Page:   page,
+	}
+	if b := r.URL.Query().Get("book_id"); b != "" {
+		bookID, err := strconv.Atoi(b)
+		if err != nil {
+			writeError(w, apperr.BadRequest("Invalid book_id"))
+			return
+		}
+		filter.BookID = bookID
+	}
+
+	requests, err := app.requestStore.GetIncomingRequests(userID, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"testbook-backend/internal/auth"
+	"testbook-backend/internal/email"
+	"testbook-backend/internal/store"
+)
+
+// countingEmail counts request notifications instead of sending them.
+type countingEmail struct {
+	*email.ConsoleEmailService
+	requests int
+}
+
+func (e *countingEmail) SendRequestNotification(toEmail, ownerName, bookTitle, requesterName string) error {
+	e.requests++
+	return nil
+}
+
+// requestTestServer serves an app with in-memory stores, where owner has put
+// up book 1 and requester has yet to sign in.
+type requestTestServer struct {
+	handler          http.Handler
+	books            *store.InMemoryBookStore
+	requests         *store.InMemoryRequestStore
+	email            *countingEmail
+	owner, requester string
+}
+
+func newRequestTestServer(t *testing.T) *requestTestServer {
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	books, users := store.NewInMemoryBookStore(), store.NewInMemoryUserStore()
+	srv := &requestTestServer{
+		books:    books,
+		requests: store.NewInMemoryRequestStore(books, users),
+		email:    &countingEmail{ConsoleEmailService: email.NewConsoleEmailService()},
+	}
+	app := &application{
+		bookStore:     books,
+		userStore:     users,
+		requestStore:  srv.requests,
+		emailService:  srv.email,
+		authenticator: authenticator,
+	}
+	srv.handler = app.routes()
+
+	mint := func(username string) string {
+		token, err := authenticator.Mint(auth.Identity{
+			Subject:  "local|" + username + "@example.com",
+			Email:    username + "@example.com",
+			Username: username,
+		}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	srv.owner, srv.requester = mint("gopher"), mint("ferris")
+
+	if rr := srv.do("POST", "/books", srv.owner, `{"title": "Dune", "author": "Frank Herbert"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("POST /books: status %d: %s", rr.Code, rr.Body)
+	}
+	return srv
+}
+
+func (srv *requestTestServer) do(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	srv.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRequestBookTwice(t *testing.T) {
+	srv := newRequestTestServer(t)
+
+	if rr := srv.do("POST", "/books/1/request", srv.requester, ""); rr.Code != http.StatusOK {
+		t.Fatalf("first request: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := srv.do("POST", "/books/1/request", srv.requester, ""); rr.Code != http.StatusConflict {
+		t.Errorf("repeated request: status %d, want %d", rr.Code, http.StatusConflict)
+	}
+	if srv.email.requests != 1 {
+		t.Errorf("owner was emailed %d times, want once", srv.email.requests)
+	}
+
+	// Once the request is withdrawn the book can be asked for again
+	if rr := srv.do("DELETE", "/books/1/request", srv.requester, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("withdraw: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := srv.do("POST", "/books/1/request", srv.requester, ""); rr.Code != http.StatusOK {
+		t.Errorf("request after withdrawing: status %d: %s", rr.Code, rr.Body)
+	}
+	if req, err := srv.requests.GetRequestByID(1); err != nil || req.Status != store.RequestCancelled {
+		t.Errorf("first request = %+v, %v, want it kept as cancelled", req, err)
+	}
+}
+
+func TestDeleteRequestedBook(t *testing.T) {
+	srv := newRequestTestServer(t)
+
+	if rr := srv.do("POST", "/books/1/request", srv.requester, ""); rr.Code != http.StatusOK {
+		t.Fatalf("request: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := srv.do("POST", "/requests/1/accept", srv.owner, ""); rr.Code != http.StatusOK {
+		t.Fatalf("accept: status %d: %s", rr.Code, rr.Body)
+	}
+
+	if rr := srv.do("DELETE", "/books/1", srv.owner, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE requested book: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := srv.do("GET", "/requests/1", srv.requester, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("request for a deleted book: status %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestOwnerAvailabilityFollowsSwaps(t *testing.T) {
+	srv := newRequestTestServer(t)
+	put := func(availability string) int {
+		return srv.do("PUT", "/books/1", srv.owner, `{"title": "Dune", "author": "Frank Herbert", "availability": "`+availability+`"}`).Code
+	}
+
+	// Only a swap reserves a book or marks it swapped
+	for _, availability := range []string{"reserved", "swapped"} {
+		if status := put(availability); status != http.StatusUnprocessableEntity {
+			t.Errorf("PUT availability %s: status %d, want %d", availability, status, http.StatusUnprocessableEntity)
+		}
+	}
+	if status := put("withdrawn"); status != http.StatusOK {
+		t.Errorf("PUT availability withdrawn: status %d, want %d", status, http.StatusOK)
+	}
+	if status := put("available"); status != http.StatusOK {
+		t.Errorf("PUT availability available: status %d, want %d", status, http.StatusOK)
+	}
+
+	if rr := srv.do("POST", "/books/1/request", srv.requester, ""); rr.Code != http.StatusOK {
+		t.Fatalf("request: status %d: %s", rr.Code, rr.Body)
+	}
+	if rr := srv.do("POST", "/requests/1/accept", srv.owner, ""); rr.Code != http.StatusOK {
+		t.Fatalf("accept: status %d: %s", rr.Code, rr.Body)
+	}
+
+	// Resending the availability the swap set is fine; changing it isn't
+	if status := put("reserved"); status != http.StatusOK {
+		t.Errorf("PUT keeping reserved: status %d, want %d", status, http.StatusOK)
+	}
+	for _, availability := range []string{"available", "withdrawn"} {
+		if status := put(availability); status != http.StatusConflict {
+			t.Errorf("PUT availability %s during a swap: status %d, want %d", availability, status, http.StatusConflict)
+		}
+	}
+	if rr := srv.do("PATCH", "/books/1", srv.owner, `{"availability": "withdrawn"}`); rr.Code != http.StatusConflict {
+		t.Errorf("PATCH availability withdrawn during a swap: status %d, want %d", rr.Code, http.StatusConflict)
+	}
+	if rr := srv.do("PATCH", "/books/1", srv.owner, `{"availability": "swapped"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PATCH availability swapped: status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if book, _ := srv.books.GetByID(1); book.Availability != store.AvailabilityReserved {
+		t.Errorf("availability = %s, want reserved", book.Availability)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 10
+)
+
+// suggestBooksHandler autocompletes the search box with titles and authors,
+// including fuzzy "did you mean" matches for misspellings.
+func (app *application) suggestBooksHandler(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultSuggestions
+	}
+	if limit > maxSuggestions {
+		limit = maxSuggestions
+	}
+
+	suggestions, err := app.bookStore.Suggest(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
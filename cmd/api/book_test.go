@@ -6,15 +6,35 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"testbook-backend/internal/auth"
+	"testbook-backend/internal/catalog"
 	"testbook-backend/internal/store"
 )
 
 func TestCreateBook(t *testing.T) {
-	// Initialize store and application
+	// Initialize stores, a local authenticator and the application
 	bookStore := store.NewInMemoryBookStore()
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 	app := &application{
-		bookStore: bookStore,
+		bookStore:     bookStore,
+		userStore:     store.NewInMemoryUserStore(),
+		authenticator: authenticator,
+	}
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// Create a new book payload
@@ -27,6 +47,7 @@ func TestCreateBook(t *testing.T) {
 	// Create request
 	req, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	// Create response recorder
 	rr := httptest.NewRecorder()
@@ -60,4 +81,253 @@ func TestCreateBook(t *testing.T) {
 	if response.ID == 0 {
 		t.Error("handler returned 0 ID, expected generated ID")
 	}
+	if response.UserUsername != "gopher" {
+		t.Errorf("handler returned unexpected owner: got %v want %v",
+			response.UserUsername, "gopher")
+	}
+}
+
+func TestPatchBook(t *testing.T) {
+	bookStore := store.NewInMemoryBookStore()
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		bookStore:     bookStore,
+		userStore:     store.NewInMemoryUserStore(),
+		authenticator: authenticator,
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first authenticated request creates the local user as ID 1
+	book, err := bookStore.Add(store.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Science Fiction", UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/books/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch(`{"description": "Spice and sandworms"}`, `"1"`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PATCH: got status %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var patched store.Book
+	if err := json.NewDecoder(rr.Body).Decode(&patched); err != nil {
+		t.Fatal(err)
+	}
+	if patched.Description != "Spice and sandworms" || patched.Genre != book.Genre || patched.Title != book.Title {
+		t.Errorf("PATCH changed more than the description: %+v", patched)
+	}
+	if got := rr.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("ETag = %s, want \"2\"", got)
+	}
+
+	// The book has moved on, so a patch based on version 1 is stale
+	if rr := patch(`{"genre": "Fantasy"}`, `"1"`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: got status %d, want %d", rr.Code, http.StatusPreconditionFailed)
+	}
+
+	// Removing a required field fails validation
+	if rr := patch(`{"title": null}`, ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("null title: got status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestUpdateBookWithLegacyGenre(t *testing.T) {
+	bookStore := store.NewInMemoryBookStore()
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		bookStore:     bookStore,
+		userStore:     store.NewInMemoryUserStore(),
+		authenticator: authenticator,
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A genre saved before the allow-list existed
+	if _, err := bookStore.Add(store.Book{Title: "Dune", Author: "Frank Herbert", Genre: "Space Opera", UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, body string) int {
+		req := httptest.NewRequest(method, "/books/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if status := send(http.MethodPut, `{"title": "Dune", "author": "Frank Herbert", "genre": "Space Opera", "description": "Spice"}`); status != http.StatusOK {
+		t.Errorf("PUT keeping the legacy genre: got status %d, want %d", status, http.StatusOK)
+	}
+	if status := send(http.MethodPatch, `{"genre": "Space Opera", "description": "Sandworms"}`); status != http.StatusOK {
+		t.Errorf("PATCH keeping the legacy genre: got status %d, want %d", status, http.StatusOK)
+	}
+	if status := send(http.MethodPut, `{"title": "Dune", "author": "Frank Herbert", "genre": "Planetary Romance"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("PUT to another unlisted genre: got status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCreateBookFromISBN(t *testing.T) {
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		bookStore:     store.NewInMemoryBookStore(),
+		userStore:     store.NewInMemoryUserStore(),
+		authenticator: authenticator,
+		bookMetadata: catalog.NewCached(catalog.Fixtures{
+			"9780306406157": {
+				Title:    "Data Structures",
+				Author:   "A. Author",
+				Subjects: []string{"Computers", "Science fiction"},
+				CoverURL: "https://covers.openlibrary.org/b/id/1-L.jpg",
+			},
+		}, store.NewInMemoryISBNCache()),
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/books", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// An ISBN-10 alone is enough; the user's own title wins over the catalogue's
+	rr := create(`{"isbn": "0-306-40615-2", "title": "My Copy"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	var book store.Book
+	if err := json.NewDecoder(rr.Body).Decode(&book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Title != "My Copy" || book.Author != "A. Author" || book.Genre != "Science Fiction" || book.ImagePath != "https://covers.openlibrary.org/b/id/1-L.jpg" {
+		t.Errorf("book wasn't filled in from the catalogue: %+v", book)
+	}
+	if book.ISBN13 != "9780306406157" || book.ISBN10 != "0306406152" {
+		t.Errorf("ISBNs = %q, %q, want 9780306406157, 0306406152", book.ISBN13, book.ISBN10)
+	}
+
+	if rr := create(`{"isbn": "0-306-40615-3", "title": "Typo", "author": "Someone"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad checksum: got status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if rr := create(`{"isbn": "9791090636071"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown ISBN without a title: got status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestBookOwnerEmailOnlyShownToOwner(t *testing.T) {
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		bookStore:     store.NewInMemoryBookStore(),
+		userStore:     store.NewInMemoryUserStore(),
+		authenticator: authenticator,
+	}
+	handler := app.routes()
+
+	mint := func(username string) string {
+		token, err := authenticator.Mint(auth.Identity{
+			Subject:  "local|" + username + "@example.com",
+			Email:    username + "@example.com",
+			Username: username,
+		}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	owner, other := mint("gopher"), mint("ferris")
+
+	body := bytes.NewBufferString(`{"title": "The Go Programming Language", "author": "Alan A. A. Donovan"}`)
+	req, _ := http.NewRequest("POST", "/books", body)
+	req.Header.Set("Authorization", "Bearer "+owner)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /books: status %d: %s", rr.Code, rr.Body)
+	}
+
+	emails := func(token string) []string {
+		req, _ := http.NewRequest("GET", "/books", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var result store.BookSearchResult
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		var emails []string
+		for _, b := range result.Results {
+			emails = append(emails, b.UserEmail)
+		}
+		return emails
+	}
+
+	if got := emails(owner); len(got) != 1 || got[0] != "gopher@example.com" {
+		t.Errorf("owner sees emails %q, want their own", got)
+	}
+	for name, token := range map[string]string{"another member": other, "a visitor": ""} {
+		if got := emails(token); len(got) != 1 || got[0] != "" {
+			t.Errorf("%s sees emails %q, want none", name, got)
+		}
+	}
 }
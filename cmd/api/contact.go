@@ -3,14 +3,12 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/validate"
 )
 
 func (app *application) contactHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var input struct {
 		Name    string `json:"name"`
 		Email   string `json:"email"`
@@ -19,17 +17,19 @@ func (app *application) contactHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Bad request"))
 		return
 	}
 
-	if input.Name == "" || input.Email == "" || input.Subject == "" || input.Message == "" {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+	v := validate.New()
+	validateContact(v, input.Name, input.Email, input.Subject, input.Message)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
 		return
 	}
 
 	if err := app.emailService.SendContactEmail(input.Email, input.Subject, input.Message); err != nil {
-		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		writeError(w, apperr.Internal("Failed to send email").Wrap(err))
 		return
 	}
 
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"testbook-backend/internal/apperr"
+)
+
+// errorResponse is the body of every error the API returns:
+//
+//	{"error": {"code": "not_found", "message": "Book not found"}}
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    apperr.Code       `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// writeError writes err as a JSON error envelope. Errors that aren't an
+// *apperr.Error are logged and reported as a generic internal error, so
+// database and upstream failures never leak to clients.
+func writeError(w http.ResponseWriter, err error) {
+	e := apperr.As(err)
+	if e == nil {
+		log.Printf("Internal error: %v", err)
+		e = apperr.Internal("Internal server error")
+	} else if e.Code == apperr.CodeInternal && e.Err != nil {
+		log.Printf("Internal error: %v", e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(apperr.HTTPStatus(e.Code))
+	json.NewEncoder(w).Encode(errorResponse{Error: errorBody{
+		Code:    e.Code,
+		Message: e.Message,
+		Fields:  e.Fields,
+	}})
+}
+
+// statusRecorder captures the status a handler writes, discarding its body.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (s *statusRecorder) Header() http.Header         { return s.header }
+func (s *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (s *statusRecorder) WriteHeader(status int)      { s.status = status }
+
+// jsonMuxErrors replaces the plain-text 404 and 405 responses ServeMux writes
+// for unmatched requests with JSON error envelopes, keeping its Allow header
+// and redirects.
+func jsonMuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{header: w.Header(), status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+
+		switch rec.status {
+		case http.StatusNotFound:
+			writeError(w, apperr.NotFound("Not found"))
+		case http.StatusMethodNotAllowed:
+			writeError(w, apperr.MethodNotAllowed("Method not allowed"))
+		default:
+			w.WriteHeader(rec.status)
+		}
+	})
+}
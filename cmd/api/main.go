@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
@@ -12,79 +11,27 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"testbook-backend/internal/auth"
+	"testbook-backend/internal/catalog"
 	"testbook-backend/internal/db"
 	"testbook-backend/internal/email"
 	"testbook-backend/internal/storage"
 	"testbook-backend/internal/store"
+	"testbook-backend/internal/webhook"
 )
 
 type application struct {
-	bookStore    store.BookStorer
-	userStore    store.UserStore
-	requestStore store.RequestStore
-	emailService email.EmailService
-	storageService storage.Service
-}
-
-func (app *application) routes() http.Handler {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/health", app.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "🚀"})
-	}))
-
-	mux.HandleFunc("/contact", app.corsMiddleware(app.contactHandler))
-
-	// Auth routes
-	mux.HandleFunc("/register", app.corsMiddleware(app.registerHandler))
-	mux.HandleFunc("/login", app.corsMiddleware(app.loginHandler))
-	mux.HandleFunc("/logout", app.corsMiddleware(app.logoutHandler))
-	mux.HandleFunc("/forgot-password", app.corsMiddleware(app.forgotPasswordHandler))
-	mux.HandleFunc("/reset-password", app.corsMiddleware(app.resetPasswordHandler))
-	mux.HandleFunc("/me", app.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut {
-			app.authMiddleware(app.updateProfileHandler)(w, r)
-		} else {
-			app.authMiddleware(app.meHandler)(w, r)
-		}
-	}))
-	mux.HandleFunc("/my-books", app.corsMiddleware(app.authMiddleware(app.userBooksHandler)))
-	mux.HandleFunc("/members", app.corsMiddleware(app.authMiddleware(app.listMembersHandler)))
-	mux.HandleFunc("/wishlist", app.corsMiddleware(app.authMiddleware(app.getWishlistHandler)))
-
-	// Book routes
-	mux.HandleFunc("/books", app.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			app.authMiddleware(app.createBookHandler)(w, r)
-		} else {
-			app.listBooksHandler(w, r)
-		}
-	}))
-	mux.HandleFunc("/books/top-requested", app.corsMiddleware(app.listTopRequestedBooksHandler))
-	mux.HandleFunc("/genres", app.corsMiddleware(app.listGenresHandler))
-	mux.HandleFunc("/genres/popular", app.corsMiddleware(app.listPopularGenresHandler))
-
-	mux.HandleFunc("/books/", app.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
-			app.authMiddleware(app.bookIDHandler)(w, r)
-		} else if len(r.URL.Path) > len("/books/") && r.URL.Path[len(r.URL.Path)-8:] == "/request" {
-			if r.Method == http.MethodPost {
-				app.authMiddleware(app.requestBookHandler)(w, r)
-			} else if r.Method == http.MethodDelete {
-				app.authMiddleware(app.deleteBookRequestHandler)(w, r)
-			}
-		} else {
-			app.bookIDHandler(w, r)
-		}
-	}))
-	mux.HandleFunc("/upload", app.corsMiddleware(app.authMiddleware(app.uploadHandler)))
-	mux.HandleFunc("/stats", app.corsMiddleware(app.getStatsHandler))
-
-	// Apply middleware chain: recovery -> logging -> security headers -> routes
-	handler := recoverMiddleware(loggingMiddleware(securityHeadersMiddleware(mux)))
-
-	return handler
+	bookStore       store.BookStorer
+	userStore       store.UserStore
+	requestStore    store.RequestStore
+	messageStore    store.MessageStore
+	mediaStore      store.MediaStore
+	emailService    email.EmailService
+	storageService  storage.Service
+	bookMetadata    catalog.BookMetadataProvider
+	webhookVerifier *webhook.SvixVerifier
+	authenticator   auth.Authenticator
+	identityCache   *auth.IdentityCache
 }
 
 func main() {
@@ -93,6 +40,14 @@ func main() {
 		log.Println("No .env file found, relying on environment variables")
 	}
 
+	// `main token ...` mints a self-issued JWT for local development
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runTokenCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Validate required environment variables
 	requiredEnvVars := []string{"DATABASE_URL"}
 	for _, envVar := range requiredEnvVars {
@@ -115,18 +70,29 @@ func main() {
 	}
 	defer dbConn.Close()
 
-	// Initialize stores
-	bookStore := store.NewPostgresBookStore(dbConn)
-	if err := bookStore.Migrate(); err != nil {
-		log.Fatal(err)
+	// `main migrate ...` manages the schema and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(dbConn, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	userStore := store.NewPostgresUserStore(dbConn)
-	if err := userStore.Migrate(); err != nil {
+	// Bring the schema up to date before serving
+	migrator, err := db.NewMigrator(dbConn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
 		log.Fatal(err)
 	}
 
+	// Initialize stores
+	bookStore := store.NewPostgresBookStore(dbConn)
+	userStore := store.NewPostgresUserStore(dbConn)
 	requestStore := store.NewPostgresRequestStore(dbConn)
+	messageStore := store.NewPostgresMessageStore(dbConn)
+	mediaStore := store.NewPostgresMediaStore(dbConn)
 
 	// Initialize email service
 	var emailService email.EmailService
@@ -140,24 +106,84 @@ func main() {
 	}
 
 	// Initialize storage service
-	var storageService storage.Service
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	if supabaseURL != "" && supabaseKey != "" {
-		storageService = storage.NewSupabaseStorage(supabaseURL, supabaseKey, "uploads")
-		log.Println("✓ Using Supabase storage service")
+	storageService, err := newStorageService()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize the book catalogue for ISBN lookups
+	var bookMetadata catalog.BookMetadataProvider
+	if path := os.Getenv("BOOK_METADATA_FIXTURES"); path != "" {
+		fixtures, err := catalog.LoadFixtures(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bookMetadata = fixtures
+		log.Println("⚠ Using fixture book catalogue (unset BOOK_METADATA_FIXTURES to use Open Library and Google Books)")
 	} else {
-		storageService = storage.NewLocalStorage("uploads")
-		log.Println("⚠ Using Local storage service (set SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY for cloud storage)")
+		bookMetadata = catalog.Chain{catalog.NewOpenLibrary(), catalog.NewGoogleBooks(os.Getenv("GOOGLE_BOOKS_API_KEY"))}
+		log.Println("✓ Using Open Library and Google Books for ISBN lookups")
+	}
+	bookMetadata = catalog.NewCached(bookMetadata, store.NewPostgresISBNCache(dbConn))
+
+	// Initialize authentication
+	authenticator, err := newAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch authenticator.(type) {
+	case *auth.ClerkAuthenticator:
+		log.Println("✓ Using Clerk authentication")
+	case *auth.LocalAuthenticator:
+		log.Println("⚠ Using self-issued JWT authentication (mint tokens with `main token`)")
+	default:
+		log.Println("⚠ No authentication configured (set CLERK_SECRET_KEY or AUTH_JWT_SECRET), authenticated routes will reject every request")
+	}
+
+	// Initialize Clerk webhook verification
+	var webhookVerifier *webhook.SvixVerifier
+	if secret := os.Getenv("CLERK_WEBHOOK_SECRET"); secret != "" {
+		webhookVerifier, err = webhook.NewSvixVerifier(secret)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("✓ Clerk webhooks enabled")
+	} else {
+		log.Println("⚠ Clerk webhooks disabled (set CLERK_WEBHOOK_SECRET to sync user lifecycle events)")
 	}
 
 	// Create application
 	app := &application{
-		bookStore:      bookStore,
-		userStore:      userStore,
-		requestStore:   requestStore,
-		emailService:   emailService,
-		storageService: storageService,
+		bookStore:       bookStore,
+		userStore:       userStore,
+		requestStore:    requestStore,
+		messageStore:    messageStore,
+		mediaStore:      mediaStore,
+		emailService:    emailService,
+		storageService:  storageService,
+		bookMetadata:    bookMetadata,
+		webhookVerifier: webhookVerifier,
+		authenticator:   authenticator,
+		identityCache:   auth.NewIdentityCache(5 * time.Minute),
+	}
+
+	// `main media ...` runs media maintenance and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "media" {
+		if err := runMediaCommand(app, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Sweep away uploads nothing refers to any more
+	mediaGrace, mediaInterval, err := mediaSweepConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	if mediaInterval > 0 {
+		go app.runMediaSweeper(sweepCtx, mediaInterval, mediaGrace)
 	}
 
 	// Create server
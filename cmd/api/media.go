@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"testbook-backend/internal/store"
+)
+
+// mediaSweepBatch is the most uploads one sweep deletes.
+const mediaSweepBatch = 500
+
+// Defaults for MEDIA_GRACE_PERIOD and MEDIA_SWEEP_INTERVAL.
+const (
+	defaultMediaGrace    = 24 * time.Hour
+	defaultMediaInterval = time.Hour
+)
+
+// sweepMedia deletes uploads that no book or user has pointed at for grace,
+// and returns them. With dryRun it only lists them.
+func (app *application) sweepMedia(grace time.Duration, dryRun bool) ([]store.Media, error) {
+	now := time.Now()
+	media, err := app.mediaStore.Unreferenced(now, now.Add(-grace), mediaSweepBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []store.Media{}
+	for _, m := range media {
+		// Uploads kept by a previous storage backend can't be deleted
+		// through this one
+		if !app.storageService.Owns(m.Path) {
+			continue
+		}
+		if dryRun {
+			deleted = append(deleted, m)
+			continue
+		}
+
+		// Forget the upload first, so nothing can start pointing at it
+		// while its files go
+		ok, err := app.mediaStore.Delete(m.ID)
+		if err != nil {
+			return deleted, err
+		}
+		if !ok {
+			continue
+		}
+		if err := app.deleteMediaFiles(m); err != nil {
+			log.Printf("Failed to delete media %s: %v", m.Path, err)
+			// Record it again so a later sweep retries
+			if _, err := app.mediaStore.Add(m); err != nil {
+				log.Printf("Failed to re-record media %s: %v", m.Path, err)
+			}
+			continue
+		}
+		deleted = append(deleted, m)
+	}
+	return deleted, nil
+}
+
+// deleteMediaFiles deletes every stored variant of an upload.
+func (app *application) deleteMediaFiles(m store.Media) error {
+	var errs []error
+	for _, path := range m.Variants {
+		if err := app.storageService.Delete(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runMediaSweeper sweeps unreferenced uploads every interval until ctx is
+// done.
+func (app *application) runMediaSweeper(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := app.sweepMedia(grace, false)
+			if err != nil {
+				log.Printf("Media sweep failed: %v", err)
+			} else if len(deleted) > 0 {
+				log.Printf("Media sweep deleted %d unreferenced uploads", len(deleted))
+			}
+		}
+	}
+}
+
+// mediaSweepConfig reads MEDIA_GRACE_PERIOD and MEDIA_SWEEP_INTERVAL, as
+// durations like "72h". An interval of 0 turns the background sweeper off.
+func mediaSweepConfig() (grace, interval time.Duration, err error) {
+	grace, interval = defaultMediaGrace, defaultMediaInterval
+	if s := os.Getenv("MEDIA_GRACE_PERIOD"); s != "" {
+		if grace, err = time.ParseDuration(s); err != nil || grace < 0 {
+			return 0, 0, fmt.Errorf("invalid MEDIA_GRACE_PERIOD %q", s)
+		}
+	}
+	if s := os.Getenv("MEDIA_SWEEP_INTERVAL"); s != "" {
+		if interval, err = time.ParseDuration(s); err != nil || interval < 0 {
+			return 0, 0, fmt.Errorf("invalid MEDIA_SWEEP_INTERVAL %q", s)
+		}
+	}
+	return grace, interval, nil
+}
+
+const mediaUsage = `usage: main media <command>
+
+commands:
+  sweep [-grace 24h] [-dry-run]  delete uploads unreferenced for the grace period`
+
+// runMediaCommand implements the `media` subcommand.
+func runMediaCommand(app *application, args []string) error {
+	if len(args) == 0 || args[0] != "sweep" {
+		return errors.New(mediaUsage)
+	}
+
+	defaultGrace, _, err := mediaSweepConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("media sweep", flag.ContinueOnError)
+	grace := fs.Duration("grace", defaultGrace, "how long an upload must have been unreferenced")
+	dryRun := fs.Bool("dry-run", false, "list the uploads that would be deleted without deleting them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	deleted, err := app.sweepMedia(*grace, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPATH\tOWNER\tUNREFERENCED SINCE")
+	for _, m := range deleted {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", m.ID, m.Path, m.OwnerID, m.UnreferencedAt.Format("2006-01-02 15:04:05"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d uploads would be deleted\n", len(deleted))
+	} else {
+		fmt.Printf("Deleted %d uploads\n", len(deleted))
+	}
+	return nil
+}
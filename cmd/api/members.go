@@ -8,9 +8,15 @@ import (
 func (app *application) listMembersHandler(w http.ResponseWriter, r *http.Request) {
 	searchQuery := r.URL.Query().Get("search")
 
-	members, err := app.userStore.GetMembers(searchQuery)
+	page, err := pageParams(r)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	members, err := app.userStore.GetMembers(searchQuery, page)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -21,9 +27,15 @@ func (app *application) listMembersHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) getWishlistHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(int)
 
-	requests, err := app.requestStore.GetRequestsByUserID(userID)
+	page, err := pageParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	requests, err := app.requestStore.GetRequestsByUserID(userID, page)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
+)
+
+const maxMessageLength = 2000
+
+func (app *application) listConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	conversations, err := app.messageStore.GetConversations(userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// conversationFromPath loads the conversation named by the {id} path
+// parameter, writing an error response and returning false if it doesn't
+// exist or the user isn't one of its participants.
+func (app *application) conversationFromPath(w http.ResponseWriter, r *http.Request) (store.Conversation, bool) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return store.Conversation{}, false
+	}
+
+	userID := r.Context().Value("userID").(int)
+	conversation, err := app.messageStore.GetConversation(id, userID)
+	if err != nil {
+		writeError(w, err)
+		return store.Conversation{}, false
+	}
+	return conversation, true
+}
+
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := app.conversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := app.messageStore.GetMessages(conversation.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"conversation": conversation,
+		"messages":     messages,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (app *application) postMessageHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := app.conversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
+		writeError(w, apperr.BadRequest("Message body is required"))
+		return
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		writeError(w, apperr.BadRequest("Message is too long"))
+		return
+	}
+
+	msg, err := app.messageStore.AddMessage(store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       r.Context().Value("userID").(int),
+		Body:           body,
+	})
+	if err != nil {
+		writeError(w, apperr.Internal("Failed to send message").Wrap(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(msg)
+}
+
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := app.conversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	if err := app.messageStore.MarkRead(conversation.ID, userID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestConversationHandler opens (or returns) the conversation attached to
+// a book request. Only the requester and the book owner can reach it.
+func (app *application) requestConversationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	req, err := app.requestStore.GetRequestByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	if userID != req.OwnerID && userID != req.RequesterID {
+		writeError(w, apperr.NotFound("Request not found"))
+		return
+	}
+
+	conversation, err := app.messageStore.GetOrCreateConversation(req.ID, userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"testbook-backend/internal/db"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up        apply all pending migrations
+  down [n]  roll back the last n migrations (default 1)
+  status    list migrations and whether they have been applied`
+
+// runMigrateCommand implements the `migrate` subcommand.
+func runMigrateCommand(dbConn *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := db.NewMigrator(dbConn)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up()
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		return migrator.Down(steps)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
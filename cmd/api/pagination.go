@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"testbook-backend/internal/store"
+)
+
+// pageParams reads the limit and cursor query parameters shared by every
+// list endpoint. Out of range limits fall back to the store's defaults.
+func pageParams(r *http.Request) (store.Page, error) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	after, err := store.DecodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		return store.Page{}, err
+	}
+	return store.Page{Limit: limit, After: after}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
+)
+
+// mergePatch is a JSON merge patch (RFC 7396) of a flat object: members that
+// are absent stay unchanged, and null removes a value.
+type mergePatch map[string]json.RawMessage
+
+func decodeMergePatch(r *http.Request) (mergePatch, error) {
+	var doc mergePatch
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc == nil {
+		return nil, apperr.BadRequest("Body must be a JSON object")
+	}
+	return doc, nil
+}
+
+// onlyFields rejects members other than allowed.
+func (p mergePatch) onlyFields(v *validate.Validator, allowed ...string) {
+	for key := range p {
+		v.Check(slices.Contains(allowed, key), key, "cannot be changed")
+	}
+}
+
+// string returns the trimmed new value of key, nil if the patch leaves it
+// alone, or "" if the patch removes it.
+func (p mergePatch) string(v *validate.Validator, key string) *string {
+	raw, ok := p[key]
+	if !ok {
+		return nil
+	}
+	s := ""
+	if !bytes.Equal(raw, []byte("null")) {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			v.Check(false, key, "must be a string")
+			return nil
+		}
+	}
+	s = strings.TrimSpace(s)
+	return &s
+}
+
+// int returns the new value of key, nil if the patch leaves it alone, or 0
+// if the patch removes it.
+func (p mergePatch) int(v *validate.Validator, key string) *int {
+	raw, ok := p[key]
+	if !ok {
+		return nil
+	}
+	n := 0
+	if !bytes.Equal(raw, []byte("null")) {
+		if err := json.Unmarshal(raw, &n); err != nil {
+			v.Check(false, key, "must be a whole number")
+			return nil
+		}
+	}
+	return &n
+}
+
+// setETag tags a response with the version of the resource it carries.
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// ifMatchVersion returns the version an If-Match header asks for, or 0 if
+// the request isn't conditional. A tag that isn't one of ours can never
+// match, so it fails the precondition outright.
+func ifMatchVersion(r *http.Request) (int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil || version <= 0 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, store.ErrVersionMismatch
+	}
+	return version, nil
+}
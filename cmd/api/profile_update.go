@@ -3,66 +3,112 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/imaging"
+	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
 )
 
+// updateProfileHandler takes the multipart profile form. Fields missing from
+// the form are left as they are; an empty username is ignored.
 func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse multipart form
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB limit
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeError(w, apperr.BadRequest("Failed to parse form"))
 		return
 	}
 
 	userID := r.Context().Value("userID").(int)
-	user, err := app.userStore.GetByID(userID)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusInternalServerError)
-		return
+
+	var patch store.UserPatch
+	if username := strings.TrimSpace(r.FormValue("username")); username != "" {
+		patch.Username = &username
+	}
+	if _, ok := r.MultipartForm.Value["bio"]; ok {
+		bio := strings.TrimSpace(r.FormValue("bio"))
+		patch.Bio = &bio
+	}
+	if _, ok := r.MultipartForm.Value["location"]; ok {
+		location := strings.TrimSpace(r.FormValue("location"))
+		patch.Location = &location
 	}
 
-	username := r.FormValue("username")
-	bio := r.FormValue("bio")
-	location := r.FormValue("location")
-	removeAvatar := r.FormValue("remove_avatar")
+	v := validate.New()
+	app.validateProfile(v, patch)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
 
 	// Handle avatar upload
-	file, header, err := r.FormFile("avatar")
-	var avatarPath string
+	file, _, err := r.FormFile("avatar")
 	if err == nil {
 		defer file.Close()
 
-		// Upload to storage service
-		path, err := app.storageService.Upload(file, header)
+		paths, err := app.storeImage(userID, file)
 		if err != nil {
-			http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
-		avatarPath = path
+		path := paths[imaging.Sizes[0].Name]
+		patch.AvatarPath = &path
+	}
+	if r.FormValue("remove_avatar") == "true" {
+		removed := ""
+		patch.AvatarPath = &removed
+	}
+
+	user, err := app.userStore.Patch(userID, patch, 0)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	// Update user fields
-	if username != "" {
-		user.Username = username
+	// Return updated user
+	setETag(w, user.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// patchProfileHandler applies a JSON merge patch to the current user's
+// profile. An If-Match header makes it conditional on the profile's version.
+func (app *application) patchProfileHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	doc, err := decodeMergePatch(r)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
-	user.Bio = bio
-	user.Location = location
 
-	if removeAvatar == "true" {
-		user.AvatarPath = ""
-	} else if avatarPath != "" {
-		user.AvatarPath = avatarPath
+	v := validate.New()
+	doc.onlyFields(v, "username", "bio", "location", "avatar_path")
+	patch := store.UserPatch{
+		Username:   doc.string(v, "username"),
+		Bio:        doc.string(v, "bio"),
+		Location:   doc.string(v, "location"),
+		AvatarPath: doc.string(v, "avatar_path"),
+	}
+	app.validateProfile(v, patch)
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
 	}
 
-	if err := app.userStore.Update(user); err != nil {
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+	userID := r.Context().Value("userID").(int)
+	user, err := app.userStore.Patch(userID, patch, version)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Return updated user
+	setETag(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
+)
+
+func (app *application) getRequestHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	req, err := app.requestStore.GetRequestByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	if userID != req.OwnerID && userID != req.RequesterID {
+		writeError(w, apperr.NotFound("Request not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// updateRequestStatusHandler returns a handler that moves the request in the
+// path to status, on behalf of whichever participant is allowed to.
+func (app *application) updateRequestStatusHandler(status store.RequestStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.updateRequestStatus(w, r, status)
+	}
+}
+
+func (app *application) updateRequestStatus(w http.ResponseWriter, r *http.Request, status store.RequestStatus) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	req, err := app.requestStore.GetRequestByID(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	isOwner := userID == req.OwnerID
+	isRequester := userID == req.RequesterID
+	if !isOwner && !isRequester {
+		writeError(w, apperr.NotFound("Request not found"))
+		return
+	}
+
+	// Only the owner decides on a request; either side can mark an accepted
+	// swap as done, and the requester can withdraw until it is completed.
+	switch status {
+	case store.RequestAccepted, store.RequestDeclined:
+		if !isOwner {
+			writeError(w, apperr.Forbidden("Only the book owner can do this"))
+			return
+		}
+	case store.RequestCancelled:
+		if !isRequester && req.Status != store.RequestAccepted {
+			writeError(w, apperr.Forbidden("Decline the request instead"))
+			return
+		}
+	}
+
+	// The store keeps the book's availability in step with the swap it is
+	// part of, in the same transaction as the status change
+	updated, err := app.requestStore.UpdateRequestStatus(id, status)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidTransition):
+			writeError(w, apperr.Conflict("Request is already "+string(req.Status)))
+		case errors.Is(err, store.ErrBookUnavailable):
+			writeError(w, err)
+		default:
+			writeError(w, apperr.Internal("Failed to update request").Wrap(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"testbook-backend/internal/store"
+)
+
+// route is one entry in the route table. Pattern uses net/http ServeMux
+// syntax, e.g. "GET /books/{id}".
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	auth    bool // Requires an authenticated user
+	noCORS  bool // Server-to-server endpoints skip CORS handling
+}
+
+func (app *application) routeTable() []route {
+	return []route{
+		{pattern: "GET /health", handler: app.healthHandler},
+		{pattern: "POST /contact", handler: app.contactHandler},
+
+		// Auth routes
+		{pattern: "POST /register", handler: app.registerHandler},
+		{pattern: "POST /login", handler: app.loginHandler},
+		{pattern: "POST /logout", handler: app.logoutHandler},
+		{pattern: "POST /forgot-password", handler: app.forgotPasswordHandler},
+		{pattern: "POST /reset-password", handler: app.resetPasswordHandler},
+		{pattern: "GET /me", handler: app.meHandler, auth: true},
+		{pattern: "PUT /me", handler: app.updateProfileHandler, auth: true},
+		{pattern: "PATCH /me", handler: app.patchProfileHandler, auth: true},
+		{pattern: "GET /my-books", handler: app.userBooksHandler, auth: true},
+		{pattern: "GET /members", handler: app.listMembersHandler, auth: true},
+		{pattern: "GET /wishlist", handler: app.getWishlistHandler, auth: true},
+
+		// Request routes
+		{pattern: "GET /my-requests/incoming", handler: app.incomingRequestsHandler, auth: true},
+		{pattern: "GET /requests/{id}", handler: app.getRequestHandler, auth: true},
+		{pattern: "POST /requests/{id}/accept", handler: app.updateRequestStatusHandler(store.RequestAccepted), auth: true},
+		{pattern: "POST /requests/{id}/decline", handler: app.updateRequestStatusHandler(store.RequestDeclined), auth: true},
+		{pattern: "POST /requests/{id}/complete", handler: app.updateRequestStatusHandler(store.RequestCompleted), auth: true},
+		{pattern: "POST /requests/{id}/cancel", handler: app.updateRequestStatusHandler(store.RequestCancelled), auth: true},
+		{pattern: "POST /requests/{id}/conversation", handler: app.requestConversationHandler, auth: true},
+
+		// Messaging routes
+		{pattern: "GET /conversations", handler: app.listConversationsHandler, auth: true},
+		{pattern: "GET /conversations/{id}", handler: app.getConversationHandler, auth: true},
+		{pattern: "POST /conversations/{id}/messages", handler: app.postMessageHandler, auth: true},
+		{pattern: "POST /conversations/{id}/read", handler: app.markConversationReadHandler, auth: true},
+
+		// Book routes
+		{pattern: "GET /books", handler: app.listBooksHandler},
+		{pattern: "POST /books", handler: app.createBookHandler, auth: true},
+		{pattern: "GET /books/top-requested", handler: app.listTopRequestedBooksHandler},
+		{pattern: "GET /books/suggest", handler: app.suggestBooksHandler},
+		{pattern: "GET /books/lookup", handler: app.lookupISBNHandler, auth: true},
+		{pattern: "GET /books/{id}", handler: app.getBookHandler},
+		{pattern: "PUT /books/{id}", handler: app.updateBookHandler, auth: true},
+		{pattern: "PATCH /books/{id}", handler: app.patchBookHandler, auth: true},
+		{pattern: "DELETE /books/{id}", handler: app.deleteBookHandler, auth: true},
+		{pattern: "POST /books/{id}/request", handler: app.requestBookHandler, auth: true},
+		{pattern: "DELETE /books/{id}/request", handler: app.withdrawBookRequestHandler, auth: true},
+		{pattern: "POST /books/{id}/images", handler: app.addBookImageHandler, auth: true},
+		{pattern: "PUT /books/{id}/images/order", handler: app.reorderBookImagesHandler, auth: true},
+		{pattern: "POST /books/{id}/images/{imageID}/cover", handler: app.setBookCoverHandler, auth: true},
+		{pattern: "DELETE /books/{id}/images/{imageID}", handler: app.removeBookImageHandler, auth: true},
+		{pattern: "GET /genres", handler: app.listGenresHandler},
+		{pattern: "GET /genres/popular", handler: app.listPopularGenresHandler},
+
+		// Work routes
+		{pattern: "GET /works/{id}", handler: app.getWorkHandler},
+		{pattern: "GET /works/{id}/copies", handler: app.workCopiesHandler},
+
+		{pattern: "POST /upload", handler: app.uploadHandler, auth: true},
+		{pattern: "POST /upload/presign", handler: app.presignUploadHandler, auth: true},
+		{pattern: "POST /upload/confirm", handler: app.confirmUploadHandler, auth: true},
+		{pattern: "GET /uploads/{name}", handler: app.serveUploadHandler},
+		{pattern: "GET /stats", handler: app.getStatsHandler},
+		{pattern: "POST /webhooks/clerk", handler: app.clerkWebhookHandler, noCORS: true},
+	}
+}
+
+func (app *application) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	preflight := make(map[string]bool)
+	for _, rt := range app.routeTable() {
+		handler := rt.handler
+		if rt.auth {
+			handler = app.authMiddleware(handler)
+		}
+		if !rt.noCORS {
+			handler = app.corsMiddleware(handler)
+			_, path, _ := strings.Cut(rt.pattern, " ")
+			preflight[path] = true
+		}
+		mux.HandleFunc(rt.pattern, handler)
+	}
+
+	// Answer CORS preflights for each path with a CORS route; the routes
+	// above only match their own methods. Anything else that matches a path
+	// but not its method gets a 405 with an Allow header from ServeMux, and
+	// unknown paths a 404.
+	for path := range preflight {
+		mux.HandleFunc("OPTIONS "+path, app.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+
+	// Apply middleware chain: recovery -> logging -> security headers -> routes
+	handler := recoverMiddleware(loggingMiddleware(securityHeadersMiddleware(jsonMuxErrors(mux))))
+
+	return handler
+}
+
+func (app *application) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "🚀"})
+}
+
+// pathID parses the {id} path parameter.
+func pathID(r *http.Request) (int, error) {
+	return strconv.Atoi(r.PathValue("id"))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"testbook-backend/internal/store"
+)
+
+func TestRoutesMethodDispatch(t *testing.T) {
+	app := &application{
+		bookStore: store.NewInMemoryBookStore(),
+		userStore: store.NewInMemoryUserStore(),
+	}
+	handler := app.routes()
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantAllow    []string
+	}{
+		{http.MethodGet, "/books/42", http.StatusNotFound, nil},
+		{http.MethodGet, "/books/abc", http.StatusBadRequest, nil},
+		{http.MethodPost, "/books/42", http.StatusMethodNotAllowed, []string{"GET", "PUT", "PATCH", "DELETE"}},
+		{http.MethodGet, "/books/42/request", http.StatusMethodNotAllowed, []string{"POST", "DELETE"}},
+		// Protected routes are reached (and rejected) rather than falling through to another handler
+		{http.MethodDelete, "/books/42/request", http.StatusUnauthorized, nil},
+		{http.MethodOptions, "/books/42/request", http.StatusOK, nil},
+		// Unknown paths are not found, whatever the method
+		{http.MethodGet, "/nope", http.StatusNotFound, nil},
+		{http.MethodGet, "/books/1/foo", http.StatusNotFound, nil},
+		{http.MethodOptions, "/nope", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.wantStatus)
+		}
+		allow := rr.Header().Get("Allow")
+		for _, m := range tt.wantAllow {
+			if !strings.Contains(allow, m) {
+				t.Errorf("%s %s: Allow %q is missing %s", tt.method, tt.path, allow, m)
+			}
+		}
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	app := &application{
+		bookStore: store.NewInMemoryBookStore(),
+		userStore: store.NewInMemoryUserStore(),
+	}
+	handler := app.routes()
+
+	tests := []struct {
+		method, path string
+		wantCode     string
+	}{
+		{http.MethodGet, "/books/42", "not_found"},
+		{http.MethodGet, "/books/abc", "bad_request"},
+		{http.MethodPost, "/books/42", "method_not_allowed"},
+		{http.MethodDelete, "/books/42/request", "unauthorized"},
+		{http.MethodGet, "/nope", "not_found"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: Content-Type %q, want application/json", tt.method, tt.path, ct)
+		}
+		var body errorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("%s %s: decoding body: %v", tt.method, tt.path, err)
+		}
+		if string(body.Error.Code) != tt.wantCode {
+			t.Errorf("%s %s: code %q, want %q", tt.method, tt.path, body.Error.Code, tt.wantCode)
+		}
+		if body.Error.Message == "" {
+			t.Errorf("%s %s: empty error message", tt.method, tt.path)
+		}
+	}
+}
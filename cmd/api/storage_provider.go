@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"testbook-backend/internal/storage"
+)
+
+// newStorageService picks the storage backend from the environment.
+// STORAGE_PROVIDER may be "s3", "supabase" or "local"; when unset, S3 is used
+// if S3_BUCKET is present, then Supabase if its URL and key are, and the
+// local filesystem otherwise.
+func newStorageService() (storage.Service, error) {
+	provider := os.Getenv("STORAGE_PROVIDER")
+	if provider == "" {
+		provider = "local"
+		if os.Getenv("SUPABASE_URL") != "" && os.Getenv("SUPABASE_SERVICE_ROLE_KEY") != "" {
+			provider = "supabase"
+		}
+		if os.Getenv("S3_BUCKET") != "" {
+			provider = "s3"
+		}
+	}
+
+	switch provider {
+	case "s3":
+		s, err := storage.NewS3Storage(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("STORAGE_PROVIDER=s3: %w", err)
+		}
+		log.Println("✓ Using S3 storage service")
+		return s, nil
+
+	case "supabase":
+		url, key := os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+		if url == "" || key == "" {
+			return nil, errors.New("STORAGE_PROVIDER=supabase needs SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY")
+		}
+		log.Println("✓ Using Supabase storage service")
+		return storage.NewSupabaseStorage(url, key, "uploads"), nil
+
+	case "local":
+		log.Println("⚠ Using Local storage service (set S3_BUCKET, or SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY, for cloud storage)")
+		return storage.NewLocalStorage("uploads"), nil
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_PROVIDER %q", provider)
+	}
+}
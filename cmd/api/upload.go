@@ -1,42 +1,259 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/imaging"
+	"testbook-backend/internal/storage"
+	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
 )
 
+// maxUploadSize is the largest image file accepted, proxied or direct.
+const maxUploadSize = 10 << 20
+
+// directUploadExpiry is how long a client has to use a direct upload URL.
+const directUploadExpiry = 15 * time.Minute
+
 func (app *application) uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		writeError(w, apperr.BadRequest("File too large"))
 		return
 	}
 
-	// Limit upload size (e.g., 10MB)
-	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "File too large", http.StatusBadRequest)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid file"))
 		return
 	}
+	defer file.Close()
 
-	file, handler, err := r.FormFile("image")
+	userID := r.Context().Value("userID").(int)
+	paths, err := app.storeImage(userID, file)
 	if err != nil {
-		http.Error(w, "Invalid file", http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+
+	// image_path is the largest variant, which books and avatars point at
+	response := map[string]interface{}{
+		"image_path": paths[imaging.Sizes[0].Name],
+		"variants":   paths,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// presignUploadHandler authorizes the client to upload one image straight to
+// the bucket. Once it has, POST /upload/confirm turns it into the usual
+// variants. Storage that can't take direct uploads, like LocalStorage,
+// only has the proxied POST /upload.
+func (app *application) presignUploadHandler(w http.ResponseWriter, r *http.Request) {
+	uploader, ok := app.storageService.(storage.DirectUploader)
+	if !ok {
+		writeError(w, apperr.NotFound("Direct uploads aren't available; use POST /upload"))
+		return
+	}
+
+	var input struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	v := validate.New()
+	v.Required("content_type", input.ContentType)
+	v.OneOf("content_type", input.ContentType, []string{"image/jpeg", "image/png", "image/gif"})
+	v.Check(input.Size > 0, "size", "is required")
+	v.Check(input.Size <= maxUploadSize, "size", "must be at most 10 MB")
+	if err := v.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// The name is unguessable and carries the uploader, so only they can
+	// confirm it
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, err)
+		return
+	}
+	userID := r.Context().Value("userID").(int)
+	name := fmt.Sprintf("incoming-%d-%s", userID, hex.EncodeToString(b))
+
+	// Recorded like any upload, so it's swept if it's never confirmed
+	path := uploader.Path(name)
+	if _, err := app.mediaStore.Add(store.Media{Path: path, Variants: []string{path}, OwnerID: userID}); err != nil {
+		writeError(w, apperr.Internal("Failed to record upload").Wrap(err))
+		return
+	}
+
+	upload, err := uploader.PresignUpload(name, input.ContentType, input.Size, directUploadExpiry)
+	if err != nil {
+		writeError(w, apperr.Internal("Failed to authorize upload").Wrap(err))
+		return
+	}
+
+	response := map[string]interface{}{
+		"name":   name,
+		"upload": upload,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// confirmUploadHandler processes an image the client uploaded directly, as
+// uploadHandler does a proxied one, then deletes the original. The response
+// is the same as uploadHandler's.
+func (app *application) confirmUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	if !strings.HasPrefix(input.Name, fmt.Sprintf("incoming-%d-", userID)) {
+		writeError(w, apperr.NotFound("Upload not found"))
+		return
+	}
+	path := app.storageService.Path(input.Name)
+
+	obj, err := app.storageService.Open(path)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, apperr.NotFound("Upload not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, apperr.Internal("Failed to read upload").Wrap(err))
+		return
+	}
+	defer obj.Close()
+	if obj.Size > maxUploadSize {
+		writeError(w, apperr.BadRequest("File too large"))
 		return
 	}
-	defer file.Close()
 
-	// Upload to storage service
-	imagePath, err := app.storageService.Upload(file, handler)
+	paths, err := app.storeImage(userID, io.LimitReader(obj.Body, maxUploadSize))
 	if err != nil {
-		http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	if err := app.storageService.Delete(path); err != nil {
+		log.Printf("Failed to delete confirmed upload %s: %v", path, err)
+	}
 
-	// Return the path (or full URL)
-	response := map[string]string{
-		"image_path": imagePath,
+	response := map[string]interface{}{
+		"image_path": paths[imaging.Sizes[0].Name],
+		"variants":   paths,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// storeImage checks that r is an image, strips its metadata and stores it
+// scaled down to each of imaging.Sizes, recorded as userID's upload. The
+// client's file name and type are ignored. It returns the stored path of
+// each variant by size name.
+func (app *application) storeImage(userID int, r io.Reader) (map[string]string, error) {
+	variants, err := imaging.Process(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every variant shares a base name, the upload time and a random suffix
+	// so uploads made at the same moment don't collide, e.g.
+	// 1700000000-9f86d081884c7d65-thumb.jpg
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("%d-%s", time.Now().Unix(), hex.EncodeToString(b))
+	names := make([]string, len(variants))
+	media := store.Media{OwnerID: userID}
+	for i, v := range variants {
+		names[i] = fmt.Sprintf("%s-%s.jpg", base, v.Name)
+		media.Variants = append(media.Variants, app.storageService.Path(names[i]))
+	}
+	media.Path = media.Variants[0]
+
+	// Record the upload before storing it, so the sweeper finds any files
+	// left behind if storing fails part way
+	if _, err := app.mediaStore.Add(media); err != nil {
+		return nil, apperr.Internal("Failed to record image").Wrap(err)
+	}
+
+	paths := make(map[string]string, len(variants))
+	for i, v := range variants {
+		path, err := app.storageService.Put(names[i], v.ContentType, v.Data)
+		if err != nil {
+			return nil, apperr.Internal("Failed to upload image").Wrap(err)
+		}
+		paths[v.Name] = path
+	}
+	return paths, nil
+}
+
+// inlineTypes are the content types uploads are shown as. Anything else is
+// sent as a download so it can't run on the API's origin.
+var inlineTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// serveUploadHandler streams a file from storage. Only LocalStorage hands
+// out /uploads/ paths; other backends serve their own files.
+func (app *application) serveUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// The {name} wildcard is a single path segment and Open rejects names
+	// with separators or dots, so this can't reach outside the store
+	obj, err := app.storageService.Open("/uploads/" + r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	// Names are never reused, so a file never changes once stored
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !inlineTypes[obj.ContentType] {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+
+	if body, ok := obj.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", obj.ModTime, body)
+		return
+	}
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	if !obj.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodHead {
+		io.Copy(w, obj.Body)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"testbook-backend/internal/auth"
+	"testbook-backend/internal/storage"
+	"testbook-backend/internal/store"
+)
+
+func TestUploadAndServe(t *testing.T) {
+	dir := t.TempDir()
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookStore, userStore := store.NewInMemoryBookStore(), store.NewInMemoryUserStore()
+	app := &application{
+		bookStore:      bookStore,
+		userStore:      userStore,
+		mediaStore:     store.NewInMemoryMediaStore(bookStore, userStore),
+		authenticator:  authenticator,
+		storageService: storage.NewLocalStorage(dir),
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("image", "photo.png")
+	if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 400, 300))); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rr.Code, rr.Body)
+	}
+
+	var uploaded struct {
+		ImagePath string            `json:"image_path"`
+		Variants  map[string]string `json:"variants"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded.Variants) != 3 || uploaded.ImagePath != uploaded.Variants["large"] {
+		t.Fatalf("upload returned %+v, want three variants with large as image_path", uploaded)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", uploaded.Variants["thumb"], nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s: got status %d", uploaded.Variants["thumb"], rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q, want image/jpeg", ct)
+	}
+	if cc := rr.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("image Content-Disposition = %q, want none", cd)
+	}
+
+	// Files that aren't images are downloaded rather than rendered
+	if err := os.WriteFile(filepath.Join(dir, "old.html"), []byte("<script>alert(1)</script>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/uploads/old.html", nil))
+	if cd := rr.Header().Get("Content-Disposition"); rr.Code != http.StatusOK || cd != "attachment" {
+		t.Errorf("GET /uploads/old.html: status %d, Content-Disposition %q", rr.Code, cd)
+	}
+
+	// Nothing outside the upload directory can be reached
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/uploads/..%2Fsecret.txt", "/uploads/%2E%2E", "/uploads/..%5Csecret.txt", "/uploads/missing.jpg"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound && rr.Code != http.StatusMovedPermanently {
+			t.Errorf("GET %s: got status %d, want 404", path, rr.Code)
+		}
+		if bytes.Contains(rr.Body.Bytes(), []byte("secret")) {
+			t.Errorf("GET %s served a file outside the upload directory", path)
+		}
+	}
+
+	if err := app.storageService.Delete(uploaded.Variants["thumb"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.storageService.Delete(uploaded.Variants["thumb"]); err != nil {
+		t.Errorf("deleting a deleted file: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", uploaded.Variants["thumb"], nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("GET deleted file: got status %d, want 404", rr.Code)
+	}
+}
+
+// directStorage adds direct uploads to LocalStorage, standing in for a
+// bucket the client writes to itself.
+type directStorage struct {
+	*storage.LocalStorage
+}
+
+func (s directStorage) PresignUpload(name, contentType string, size int64, expires time.Duration) (*storage.DirectUpload, error) {
+	return &storage.DirectUpload{Method: "PUT", URL: "https://bucket.example.com/" + name, ExpiresAt: time.Now().Add(expires)}, nil
+}
+
+func TestDirectUpload(t *testing.T) {
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := storage.NewLocalStorage(t.TempDir())
+	bookStore, userStore := store.NewInMemoryBookStore(), store.NewInMemoryUserStore()
+	app := &application{
+		bookStore:      bookStore,
+		userStore:      userStore,
+		mediaStore:     store.NewInMemoryMediaStore(bookStore, userStore),
+		authenticator:  authenticator,
+		storageService: local,
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// LocalStorage only takes proxied uploads
+	if rr := post("/upload/presign", `{"content_type": "image/png", "size": 1000}`); rr.Code != http.StatusNotFound {
+		t.Errorf("presign with LocalStorage: got status %d, want 404", rr.Code)
+	}
+
+	app.storageService = directStorage{local}
+	handler = app.routes()
+	if rr := post("/upload/presign", `{"content_type": "text/html", "size": 20000000}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("presign HTML: got status %d, want 422", rr.Code)
+	}
+
+	rr := post("/upload/presign", `{"content_type": "image/png", "size": 1000}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("presign: got status %d: %s", rr.Code, rr.Body)
+	}
+	var presigned struct {
+		Name   string               `json:"name"`
+		Upload storage.DirectUpload `json:"upload"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&presigned); err != nil {
+		t.Fatal(err)
+	}
+
+	confirm := `{"name": "` + presigned.Name + `"}`
+	if rr := post("/upload/confirm", confirm); rr.Code != http.StatusNotFound {
+		t.Errorf("confirm before uploading: got status %d, want 404", rr.Code)
+	}
+
+	// The client uploads straight to the bucket
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+	if _, err := local.Put(presigned.Name, "image/png", img.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Put("incoming-999-abc", "image/png", img.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := post("/upload/confirm", `{"name": "incoming-999-abc"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("confirm another user's upload: got status %d, want 404", rr.Code)
+	}
+
+	rr = post("/upload/confirm", confirm)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("confirm: got status %d: %s", rr.Code, rr.Body)
+	}
+	var uploaded struct {
+		ImagePath string            `json:"image_path"`
+		Variants  map[string]string `json:"variants"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded.Variants) != 3 || !local.Owns(uploaded.ImagePath) {
+		t.Errorf("confirm returned %+v, want three stored variants", uploaded)
+	}
+	if _, err := local.Open(local.Path(presigned.Name)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("original upload still stored after confirming: %v", err)
+	}
+}
+
+func TestMediaSweep(t *testing.T) {
+	authenticator, err := auth.NewLocalAuthenticator(auth.LocalConfig{
+		Secret: []byte("test-secret-that-is-at-least-32-bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := storage.NewLocalStorage(t.TempDir())
+	bookStore, userStore := store.NewInMemoryBookStore(), store.NewInMemoryUserStore()
+	app := &application{
+		bookStore:      bookStore,
+		userStore:      userStore,
+		mediaStore:     store.NewInMemoryMediaStore(bookStore, userStore),
+		authenticator:  authenticator,
+		storageService: local,
+	}
+	handler := app.routes()
+
+	token, err := authenticator.Mint(auth.Identity{
+		Subject:  "local|gopher@example.com",
+		Email:    "gopher@example.com",
+		Username: "gopher",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path, contentType string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	upload := func() map[string]string {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("image", "photo.png")
+		png.Encode(part, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+		form.Close()
+
+		rr := do("POST", "/upload", form.FormDataContentType(), &body)
+		var uploaded struct {
+			Variants map[string]string `json:"variants"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&uploaded); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("upload: status %d, %v", rr.Code, err)
+		}
+		return uploaded.Variants
+	}
+	stored := func(variants map[string]string) int {
+		n := 0
+		for _, path := range variants {
+			if obj, err := local.Open(path); err == nil {
+				obj.Close()
+				n++
+			}
+		}
+		return n
+	}
+	sweep := func(grace time.Duration, dryRun bool) int {
+		deleted, err := app.sweepMedia(grace, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(deleted)
+	}
+
+	cover, unused := upload(), upload()
+	rr := do("POST", "/books", "application/json", strings.NewReader(`{"title": "Dune", "author": "Frank Herbert", "image_path": "`+cover["large"]+`"}`))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create book: status %d: %s", rr.Code, rr.Body)
+	}
+	var book store.Book
+	json.NewDecoder(rr.Body).Decode(&book)
+
+	if n := sweep(time.Hour, false); n != 0 {
+		t.Errorf("sweep within the grace period deleted %d uploads", n)
+	}
+	if n := sweep(0, true); n != 1 || stored(unused) != 3 {
+		t.Errorf("dry run listed %d uploads and left %d of 3 files, want 1 and 3", n, stored(unused))
+	}
+	if n := sweep(0, false); n != 1 {
+		t.Errorf("sweep deleted %d uploads, want the unused one", n)
+	}
+	if stored(unused) != 0 || stored(cover) != 3 {
+		t.Errorf("after sweeping, %d unused and %d cover files are left, want 0 and 3", stored(unused), stored(cover))
+	}
+
+	// Deleting the book leaves its cover unreferenced. The grace period
+	// starts when a sweep first sees that, so the next one deletes it.
+	if rr := do("DELETE", "/books/"+strconv.Itoa(book.ID), "", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete book: status %d", rr.Code)
+	}
+	if n := sweep(0, false); n != 0 {
+		t.Errorf("sweep deleted %d uploads as soon as they became unreferenced", n)
+	}
+	if n := sweep(0, false); n != 1 || stored(cover) != 0 {
+		t.Errorf("sweep after deleting the book deleted %d uploads, left %d cover files", n, stored(cover))
+	}
+}
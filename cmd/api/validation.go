@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"testbook-backend/internal/catalog"
+	"testbook-backend/internal/store"
+	"testbook-backend/internal/validate"
+)
+
+// Field limits shared by the handlers that accept user input.
+const (
+	maxTitleLength       = 200
+	maxAuthorLength      = 200
+	maxDescriptionLength = 5000
+	minUsernameLength    = 3
+	maxUsernameLength    = 30
+	maxBioLength         = 500
+	maxLocationLength    = 100
+	maxNameLength        = 100
+	maxSubjectLength     = 200
+	maxContactLength     = 5000
+	maxPageCount         = 20000
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+)
+
+// bookInput is the editable part of a book, as accepted by the create and
+// update endpoints.
+type bookInput struct {
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+	Genre       string `json:"genre"`
+	ImagePath   string `json:"image_path"`
+	ISBN        string `json:"isbn"`
+	Condition   string `json:"condition"`
+	Language    string `json:"language"`
+	Format      string `json:"format"`
+	PageCount   int    `json:"page_count"`
+}
+
+func (in *bookInput) trim() {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Author = strings.TrimSpace(in.Author)
+	in.Description = strings.TrimSpace(in.Description)
+	in.Genre = strings.TrimSpace(in.Genre)
+	in.ImagePath = strings.TrimSpace(in.ImagePath)
+	in.ISBN = normalizeISBN(in.ISBN)
+	in.Condition = strings.TrimSpace(in.Condition)
+	in.Language = strings.ToLower(strings.TrimSpace(in.Language))
+	in.Format = strings.TrimSpace(in.Format)
+}
+
+// normalizeISBN returns a valid ISBN as a bare ISBN-13 and anything else
+// trimmed, for validateBook to reject.
+func normalizeISBN(s string) string {
+	if isbn, err := catalog.ParseISBN(s); err == nil {
+		return isbn
+	}
+	return strings.TrimSpace(s)
+}
+
+// patch returns in as a BookPatch that sets every field.
+func (in bookInput) patch() store.BookPatch {
+	return store.BookPatch{
+		Title:       &in.Title,
+		Author:      &in.Author,
+		Description: &in.Description,
+		Genre:       &in.Genre,
+		ImagePath:   &in.ImagePath,
+		ISBN:        &in.ISBN,
+		Condition:   (*store.Condition)(&in.Condition),
+		Language:    &in.Language,
+		Format:      (*store.Format)(&in.Format),
+		PageCount:   &in.PageCount,
+	}
+}
+
+// keepUnchanged takes an unchanged genre and availability out of p, so books
+// saved with a genre from before the allow-list can still be edited without
+// choosing a new one, and a full update can resend an availability only a
+// swap could have set.
+func keepUnchanged(p *store.BookPatch, book store.Book) {
+	if p.Genre != nil && *p.Genre == book.Genre {
+		p.Genre = nil
+	}
+	if p.Availability != nil && *p.Availability == book.Availability {
+		p.Availability = nil
+	}
+}
+
+// validateBook checks the fields set in p, so partial updates aren't
+// rejected over fields they leave alone.
+func (app *application) validateBook(v *validate.Validator, p store.BookPatch) {
+	if p.Title != nil {
+		v.Required("title", *p.Title)
+		v.MaxLength("title", *p.Title, maxTitleLength)
+	}
+	if p.Author != nil {
+		v.Required("author", *p.Author)
+		v.MaxLength("author", *p.Author, maxAuthorLength)
+	}
+	if p.Description != nil {
+		v.MaxLength("description", *p.Description, maxDescriptionLength)
+	}
+	if p.Genre != nil {
+		v.OneOf("genre", *p.Genre, store.Genres)
+	}
+	if p.ImagePath != nil && !catalog.IsCoverURL(*p.ImagePath) {
+		app.validateStoragePath(v, "image_path", *p.ImagePath)
+	}
+	if p.ISBN != nil && *p.ISBN != "" {
+		_, err := catalog.ParseISBN(*p.ISBN)
+		v.Check(err == nil, "isbn", "is not a valid ISBN-10 or ISBN-13")
+	}
+	if p.Condition != nil {
+		v.Check(*p.Condition == "" || p.Condition.Valid(), "condition", "is not an allowed value")
+	}
+	if p.Language != nil {
+		v.Check(*p.Language == "" || languagePattern.MatchString(*p.Language), "language", "must be an ISO 639 language code")
+	}
+	if p.Format != nil {
+		v.Check(*p.Format == "" || p.Format.Valid(), "format", "is not an allowed value")
+	}
+	if p.PageCount != nil {
+		v.Check(*p.PageCount >= 0 && *p.PageCount <= maxPageCount, "page_count", "is out of range")
+	}
+	// Reserved and swapped follow the book's requests
+	if p.Availability != nil {
+		v.Check(*p.Availability == store.AvailabilityAvailable || *p.Availability == store.AvailabilityWithdrawn, "availability", "can only be set to available or withdrawn")
+	}
+}
+
+// validateProfile checks the fields set in p.
+func (app *application) validateProfile(v *validate.Validator, p store.UserPatch) {
+	if p.Username != nil {
+		v.Required("username", *p.Username)
+		v.MinLength("username", *p.Username, minUsernameLength)
+		v.MaxLength("username", *p.Username, maxUsernameLength)
+		v.Check(*p.Username == "" || usernamePattern.MatchString(*p.Username), "username", "may only contain letters, digits, '.', '_' and '-'")
+	}
+	if p.Bio != nil {
+		v.MaxLength("bio", *p.Bio, maxBioLength)
+	}
+	if p.Location != nil {
+		v.MaxLength("location", *p.Location, maxLocationLength)
+	}
+	if p.AvatarPath != nil {
+		app.validateStoragePath(v, "avatar_path", *p.AvatarPath)
+	}
+}
+
+func validateContact(v *validate.Validator, name, email, subject, message string) {
+	v.Required("name", name)
+	v.MaxLength("name", name, maxNameLength)
+	v.Required("email", email)
+	v.Email("email", email)
+	v.Required("subject", subject)
+	v.MaxLength("subject", subject, maxSubjectLength)
+	v.Required("message", message)
+	v.MaxLength("message", message, maxContactLength)
+}
+
+// validateStoragePath checks that an image path, if set, was issued by our
+// storage service rather than pointing somewhere arbitrary.
+func (app *application) validateStoragePath(v *validate.Validator, field, path string) {
+	if path == "" {
+		return
+	}
+	v.Check(app.storageService != nil && app.storageService.Owns(path), field, "must be an uploaded image")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"testbook-backend/internal/apperr"
+	"testbook-backend/internal/store"
+)
+
+// clerkEvent is the envelope Clerk sends for every webhook event.
+type clerkEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// clerkUserData is the subset of Clerk's user object we keep locally.
+type clerkUserData struct {
+	ID                    string  `json:"id"`
+	Username              *string `json:"username"`
+	ImageURL              string  `json:"image_url"`
+	PrimaryEmailAddressID string  `json:"primary_email_address_id"`
+	EmailAddresses        []struct {
+		ID           string `json:"id"`
+		EmailAddress string `json:"email_address"`
+	} `json:"email_addresses"`
+}
+
+func (d clerkUserData) primaryEmail() string {
+	for _, e := range d.EmailAddresses {
+		if e.ID == d.PrimaryEmailAddressID {
+			return e.EmailAddress
+		}
+	}
+	if len(d.EmailAddresses) > 0 {
+		return d.EmailAddresses[0].EmailAddress
+	}
+	return ""
+}
+
+func (app *application) clerkWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if app.webhookVerifier == nil {
+		log.Println("CLERK_WEBHOOK_SECRET not set, rejecting Clerk webhook")
+		writeError(w, apperr.Unavailable("Webhooks not configured"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	if err := app.webhookVerifier.Verify(r.Header, body); err != nil {
+		writeError(w, apperr.Unauthorized("Invalid signature"))
+		return
+	}
+
+	var event clerkEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	var data clerkUserData
+	if err := json.Unmarshal(event.Data, &data); err != nil || data.ID == "" {
+		writeError(w, apperr.BadRequest("Bad request"))
+		return
+	}
+
+	switch event.Type {
+	case "user.created", "user.updated":
+		email := data.primaryEmail()
+		if email == "" {
+			// Nothing to key a local account on yet; Clerk will send an update once there is.
+			break
+		}
+		username := ""
+		if data.Username != nil {
+			username = *data.Username
+		}
+		if _, err := app.userStore.UpsertByClerkID(store.User{
+			ClerkID:    data.ID,
+			Email:      email,
+			Username:   username,
+			AvatarPath: data.ImageURL,
+		}); err != nil {
+			log.Printf("Failed to sync Clerk user %s: %v", data.ID, err)
+			writeError(w, err)
+			return
+		}
+
+	case "user.deleted":
+		app.identityCache.Delete(data.ID)
+		if err := app.userStore.DeleteByClerkID(data.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to delete Clerk user %s: %v", data.ID, err)
+			writeError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"testbook-backend/internal/apperr"
+)
+
+// getWorkHandler shows a work with how many copies of it are listed.
+func (app *application) getWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	work, err := app.bookStore.GetWork(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(work)
+}
+
+// workCopiesHandler lists the copies of a work and who has them. It takes
+// the same filters as GET /books, so copies can be narrowed to a location
+// and default to available ones.
+func (app *application) workCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, apperr.BadRequest("Invalid ID"))
+		return
+	}
+
+	filter, err := bookFilterParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	filter.WorkID = id
+
+	if _, err := app.bookStore.GetWork(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result, err := app.bookStore.Search(filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	app.redactOwners(r, result.Results)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
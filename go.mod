@@ -3,14 +3,12 @@ module testbook-backend
 go 1.24.5
 
 require (
+	github.com/clerk/clerk-sdk-go/v2 v2.5.0
 	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
+	github.com/resend/resend-go/v2 v2.28.0
 	golang.org/x/crypto v0.45.0
 )
 
-require (
-	github.com/clerk/clerk-sdk-go/v2 v2.5.0 // indirect
-	github.com/go-jose/go-jose/v3 v3.0.4 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/resend/resend-go/v2 v2.28.0 // indirect
-)
+require github.com/go-jose/go-jose/v3 v3.0.4 // indirect
@@ -0,0 +1,145 @@
+// Package apperr defines the typed errors shared by the stores and the API.
+// Stores return them so handlers can tell a missing row from a broken
+// database, and the API turns them into its JSON error envelope.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodePrecondition     Code = "precondition_failed"
+	CodeGone             Code = "gone"
+	CodeUnavailable      Code = "unavailable"
+	CodeInternal         Code = "internal"
+)
+
+// Error is an error a client can act on. Message is safe to show to users;
+// Err, if set, is the underlying cause and is never exposed.
+type Error struct {
+	Code    Code
+	Message string
+	Fields  map[string]string // Per-field messages for validation failures
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns a copy of e with err as its cause.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func BadRequest(message string) *Error {
+	return &Error{Code: CodeBadRequest, Message: message}
+}
+
+// Validation reports which input fields were rejected and why.
+func Validation(fields map[string]string) *Error {
+	return &Error{Code: CodeValidation, Message: "Validation failed", Fields: fields}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+func MethodNotAllowed(message string) *Error {
+	return &Error{Code: CodeMethodNotAllowed, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+// PreconditionFailed is for conditional requests, such as an If-Match
+// update, whose condition no longer holds.
+func PreconditionFailed(message string) *Error {
+	return &Error{Code: CodePrecondition, Message: message}
+}
+
+func Gone(message string) *Error {
+	return &Error{Code: CodeGone, Message: message}
+}
+
+func Unavailable(message string) *Error {
+	return &Error{Code: CodeUnavailable, Message: message}
+}
+
+// Internal is for failures the client can't do anything about. Its message
+// is still shown, so keep details in the wrapped cause.
+func Internal(message string) *Error {
+	return &Error{Code: CodeInternal, Message: message}
+}
+
+// As returns the *Error in err's chain, or nil.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+// CodeOf returns the code of the *Error in err's chain, or CodeInternal.
+func CodeOf(err error) Code {
+	if e := As(err); e != nil {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// HTTPStatus maps a code to the status the API responds with.
+func HTTPStatus(code Code) int {
+	switch code {
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	case CodeValidation:
+		return http.StatusUnprocessableEntity
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodeConflict:
+		return http.StatusConflict
+	case CodePrecondition:
+		return http.StatusPreconditionFailed
+	case CodeGone:
+		return http.StatusGone
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
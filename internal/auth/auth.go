@@ -0,0 +1,14 @@
+package auth
+
+import "context"
+
+// Authenticator verifies session tokens issued by an identity provider.
+type Authenticator interface {
+	// Verify checks the token and returns who it was issued to. It returns
+	// ErrInvalidToken for tokens that are malformed, forged or expired.
+	Verify(ctx context.Context, token string) (Identity, error)
+
+	// Profile looks up the email, username and avatar for a subject, for
+	// providers whose tokens don't carry them.
+	Profile(ctx context.Context, subject string) (Identity, error)
+}
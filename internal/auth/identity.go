@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Identity is who a verified token belongs to. Subject is always set; the
+// profile fields are only filled in when the provider has them to hand.
+type Identity struct {
+	Subject   string
+	Email     string
+	Username  string
+	AvatarURL string
+}
+
+// IdentityCache remembers which local user a token subject maps to for a
+// short while, so repeat requests skip the database lookup. A nil
+// *IdentityCache is valid and caches nothing.
+type IdentityCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]identityEntry
+}
+
+type identityEntry struct {
+	userID  int
+	expires time.Time
+}
+
+func NewIdentityCache(ttl time.Duration) *IdentityCache {
+	return &IdentityCache{
+		ttl:     ttl,
+		entries: make(map[string]identityEntry),
+	}
+}
+
+func (c *IdentityCache) Get(subject string) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[subject]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, subject)
+		return 0, false
+	}
+	return e.userID, true
+}
+
+func (c *IdentityCache) Set(subject string, userID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	// Drop expired entries as we go so the map can't grow without bound.
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[subject] = identityEntry{userID: userID, expires: now.Add(c.ttl)}
+}
+
+// Delete forgets a subject, e.g. when its account is deleted.
+func (c *IdentityCache) Delete(subject string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, subject)
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+)
+
+func TestLocalAuthenticatorRoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := map[string]LocalConfig{
+		"HS256": {Secret: []byte("0123456789abcdef0123456789abcdef")},
+		"RS256": {PrivateKey: key},
+	}
+
+	identity := Identity{Subject: "local|reader@example.com", Email: "reader@example.com", Username: "reader"}
+	for name, cfg := range configs {
+		a, err := NewLocalAuthenticator(cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		token, err := a.Mint(identity, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := a.Verify(context.Background(), token)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != identity {
+			t.Errorf("%s: got %+v, want %+v", name, got, identity)
+		}
+
+		expired, _ := a.Mint(identity, -time.Minute)
+		if _, err := a.Verify(context.Background(), expired); err != ErrInvalidToken {
+			t.Errorf("%s: expired token: got %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestLocalAuthenticatorRejectsForeignTokens(t *testing.T) {
+	ours, _ := NewLocalAuthenticator(LocalConfig{Secret: []byte("0123456789abcdef0123456789abcdef")})
+	theirs, _ := NewLocalAuthenticator(LocalConfig{Secret: []byte("fedcba9876543210fedcba9876543210")})
+
+	token, err := theirs.Mint(Identity{Subject: "x", Email: "x@example.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ours.Verify(context.Background(), token); err != ErrInvalidToken {
+		t.Errorf("got %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,137 @@
+// Package catalog looks up book details by ISBN from public catalogues, so
+// a book can be listed from its ISBN alone.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+var ErrNotFound = apperr.NotFound("No book found for that ISBN")
+
+// Metadata is what a catalogue knows about an edition.
+type Metadata struct {
+	ISBN        string   `json:"isbn"` // ISBN-13
+	Title       string   `json:"title"`
+	Author      string   `json:"author"` // Authors joined with ", "
+	Description string   `json:"description"`
+	Subjects    []string `json:"subjects"`
+	CoverURL    string   `json:"cover_url"`
+	PageCount   int      `json:"page_count,omitempty"`
+	Language    string   `json:"language,omitempty"` // ISO 639-1 code, where known
+	Source      string   `json:"source"`             // Name of the provider it came from
+}
+
+// BookMetadataProvider is a catalogue of books.
+type BookMetadataProvider interface {
+	// Lookup returns the metadata for a bare ISBN-13, or ErrNotFound if the
+	// catalogue doesn't have it.
+	Lookup(ctx context.Context, isbn string) (Metadata, error)
+}
+
+// Chain asks each provider in turn until one has the book. A provider that
+// fails is logged and skipped, so one catalogue being down doesn't stop
+// lookups in the others.
+type Chain []BookMetadataProvider
+
+func (c Chain) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	var failed error
+	for _, p := range c {
+		m, err := p.Lookup(ctx, isbn)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("catalog: lookup of %s failed: %v", isbn, err)
+			failed = err
+		}
+	}
+	if failed != nil {
+		return Metadata{}, failed
+	}
+	return Metadata{}, ErrNotFound
+}
+
+// CacheEntry is a remembered lookup. Found is false for ISBNs no provider
+// had, so those aren't asked for again straight away either.
+type CacheEntry struct {
+	Metadata  Metadata
+	Found     bool
+	FetchedAt time.Time
+}
+
+// Cache stores lookups by ISBN-13.
+type Cache interface {
+	GetLookup(isbn string) (CacheEntry, bool, error)
+	PutLookup(isbn string, entry CacheEntry) error
+}
+
+// How long lookups are trusted. Catalogue records rarely change, but a book
+// that wasn't found may be added later.
+const (
+	foundTTL    = 30 * 24 * time.Hour
+	notFoundTTL = 24 * time.Hour
+)
+
+// Cached fronts a provider with a Cache.
+type Cached struct {
+	Provider BookMetadataProvider
+	Cache    Cache
+}
+
+func NewCached(provider BookMetadataProvider, cache Cache) *Cached {
+	return &Cached{Provider: provider, Cache: cache}
+}
+
+func (c *Cached) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	entry, ok, err := c.Cache.GetLookup(isbn)
+	if err != nil {
+		log.Printf("catalog: reading cached lookup of %s: %v", isbn, err)
+	}
+	if ok && entry.Found && time.Since(entry.FetchedAt) < foundTTL {
+		return entry.Metadata, nil
+	}
+	if ok && !entry.Found && time.Since(entry.FetchedAt) < notFoundTTL {
+		return Metadata{}, ErrNotFound
+	}
+
+	m, err := c.Provider.Lookup(ctx, isbn)
+	switch {
+	case err == nil:
+		entry = CacheEntry{Metadata: m, Found: true, FetchedAt: time.Now()}
+	case errors.Is(err, ErrNotFound):
+		entry = CacheEntry{FetchedAt: time.Now()}
+	default:
+		// Don't remember outages
+		return Metadata{}, err
+	}
+	if err := c.Cache.PutLookup(isbn, entry); err != nil {
+		log.Printf("catalog: caching lookup of %s: %v", isbn, err)
+	}
+	if !entry.Found {
+		return Metadata{}, ErrNotFound
+	}
+	return m, nil
+}
+
+// coverPrefixes are where the providers' cover images are served from.
+var coverPrefixes = []string{
+	"https://covers.openlibrary.org/",
+	"https://books.google.com/books/",
+}
+
+// IsCoverURL reports whether u is a cover image from one of the catalogues,
+// which books may use in place of an uploaded photo.
+func IsCoverURL(u string) bool {
+	for _, prefix := range coverPrefixes {
+		if strings.HasPrefix(u, prefix) && !strings.Contains(u[len(prefix):], "..") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0-306-40615-2", "9780306406157"},
+		{"978-0-306-40615-7", "9780306406157"},
+		{"9780306406157", "9780306406157"},
+		{"080442957x", "9780804429573"}, // X check digit
+		{"979-10-90636-07-1", "9791090636071"},
+	}
+	for _, tt := range tests {
+		got, err := ParseISBN(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseISBN(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "0-306-40615-3", "9780306406158", "12345", "abcdefghij", "1234567890123"} {
+		if _, err := ParseISBN(bad); err != ErrInvalidISBN {
+			t.Errorf("ParseISBN(%q) error = %v, want ErrInvalidISBN", bad, err)
+		}
+	}
+
+	if got := ISBN10("9780306406157"); got != "0306406152" {
+		t.Errorf("ISBN10 = %q, want 0306406152", got)
+	}
+	if got := ISBN10("9791090636071"); got != "" {
+		t.Errorf("ISBN10 of a 979 number = %q, want none", got)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/books" && r.URL.Query().Get("bibkeys") == "ISBN:9780306406157":
+			w.Write([]byte(`{"ISBN:9780306406157": {
+				"title": "Data Structures",
+				"subtitle": "An Introduction",
+				"authors": [{"name": "A. Author"}, {"name": "B. Author"}],
+				"subjects": [{"name": "Computer science"}],
+				"notes": {"type": "/type/text", "value": "A textbook."},
+				"cover": {"medium": "https://covers.openlibrary.org/b/id/1-M.jpg", "large": "https://covers.openlibrary.org/b/id/1-L.jpg"}
+			}}`))
+		case r.URL.Path == "/api/books":
+			w.Write([]byte(`{}`))
+		case r.URL.Path == "/books/v1/volumes" && r.URL.Query().Get("q") == "isbn:9780306406157":
+			w.Write([]byte(`{"items": [{"volumeInfo": {
+				"title": "Data Structures",
+				"authors": ["A. Author"],
+				"description": "A textbook.",
+				"categories": ["Science"],
+				"imageLinks": {"thumbnail": "http://books.google.com/books/content?id=1"}
+			}}]}`))
+		case r.URL.Path == "/books/v1/volumes":
+			w.Write([]byte(`{"totalItems": 0}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ol := &OpenLibrary{BaseURL: srv.URL}
+	m, err := ol.Lookup(context.Background(), "9780306406157")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "Data Structures: An Introduction" || m.Author != "A. Author, B. Author" || m.Description != "A textbook." || m.CoverURL != "https://covers.openlibrary.org/b/id/1-L.jpg" {
+		t.Errorf("OpenLibrary.Lookup = %+v", m)
+	}
+
+	gb := &GoogleBooks{BaseURL: srv.URL}
+	m, err = gb.Lookup(context.Background(), "9780306406157")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "Data Structures" || len(m.Subjects) != 1 || m.CoverURL != "https://books.google.com/books/content?id=1" {
+		t.Errorf("GoogleBooks.Lookup = %+v", m)
+	}
+
+	for _, p := range []BookMetadataProvider{ol, gb} {
+		if _, err := p.Lookup(context.Background(), "9791090636071"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%T.Lookup of an unknown ISBN: error = %v, want ErrNotFound", p, err)
+		}
+	}
+}
+
+// countingProvider counts lookups that reach it.
+type countingProvider struct {
+	Fixtures
+	calls int
+}
+
+func (p *countingProvider) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	p.calls++
+	return p.Fixtures.Lookup(ctx, isbn)
+}
+
+type mapCache map[string]CacheEntry
+
+func (c mapCache) GetLookup(isbn string) (CacheEntry, bool, error) {
+	e, ok := c[isbn]
+	return e, ok, nil
+}
+
+func (c mapCache) PutLookup(isbn string, e CacheEntry) error {
+	c[isbn] = e
+	return nil
+}
+
+func TestCached(t *testing.T) {
+	provider := &countingProvider{Fixtures: Fixtures{"9780306406157": {Title: "Data Structures"}}}
+	cached := NewCached(provider, mapCache{})
+
+	for i := 0; i < 2; i++ {
+		if m, err := cached.Lookup(context.Background(), "9780306406157"); err != nil || m.Title != "Data Structures" {
+			t.Fatalf("Lookup = %+v, %v", m, err)
+		}
+		if _, err := cached.Lookup(context.Background(), "9791090636071"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Lookup of an unknown ISBN: error = %v, want ErrNotFound", err)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider was asked %d times, want 2: hits and misses should both be cached", provider.calls)
+	}
+}
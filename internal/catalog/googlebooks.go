@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GoogleBooks looks books up in the Google Books API. The API key is
+// optional but raises the rate limit.
+type GoogleBooks struct {
+	BaseURL string // Defaults to https://www.googleapis.com
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewGoogleBooks(apiKey string) *GoogleBooks {
+	return &GoogleBooks{BaseURL: "https://www.googleapis.com", APIKey: apiKey}
+}
+
+type googleVolumes struct {
+	Items []struct {
+		VolumeInfo struct {
+			Title       string   `json:"title"`
+			Subtitle    string   `json:"subtitle"`
+			Authors     []string `json:"authors"`
+			Description string   `json:"description"`
+			Categories  []string `json:"categories"`
+			PageCount   int      `json:"pageCount"`
+			Language    string   `json:"language"`
+			ImageLinks  struct {
+				Thumbnail string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (p *GoogleBooks) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	q := url.Values{"q": {"isbn:" + isbn}}
+	if p.APIKey != "" {
+		q.Set("key", p.APIKey)
+	}
+
+	var found googleVolumes
+	if err := getJSON(ctx, p.Client, p.BaseURL+"/books/v1/volumes?"+q.Encode(), &found); err != nil {
+		return Metadata{}, err
+	}
+	if len(found.Items) == 0 || found.Items[0].VolumeInfo.Title == "" {
+		return Metadata{}, ErrNotFound
+	}
+
+	v := found.Items[0].VolumeInfo
+	return Metadata{
+		ISBN:        isbn,
+		Title:       joinTitle(v.Title, v.Subtitle),
+		Author:      strings.Join(v.Authors, ", "),
+		Description: v.Description,
+		Subjects:    v.Categories,
+		PageCount:   v.PageCount,
+		Language:    v.Language,
+		// Thumbnails are served over plain http by default
+		CoverURL: strings.Replace(v.ImageLinks.Thumbnail, "http://", "https://", 1),
+		Source:   "googlebooks",
+	}, nil
+}
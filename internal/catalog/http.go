@@ -0,0 +1,39 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultClient bounds how long a catalogue can hold up creating a book.
+var defaultClient = &http.Client{Timeout: 5 * time.Second}
+
+// getJSON fetches url and decodes its JSON body into dst. A 404 is
+// ErrNotFound.
+func getJSON(ctx context.Context, client *http.Client, url string, dst interface{}) error {
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("catalog: GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
@@ -0,0 +1,83 @@
+package catalog
+
+import (
+	"strings"
+
+	"testbook-backend/internal/apperr"
+)
+
+var ErrInvalidISBN = apperr.BadRequest("Invalid ISBN")
+
+// ParseISBN checks an ISBN-10 or ISBN-13, which may contain hyphens or
+// spaces, and returns it as a bare ISBN-13. Every edition gets one ISBN-13,
+// so it is the form books are stored and looked up by.
+func ParseISBN(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	switch {
+	case len(s) == 10 && validISBN10(s):
+		body := "978" + s[:9]
+		return body + string(isbn13Check(body)), nil
+	case len(s) == 13 && validISBN13(s):
+		return s, nil
+	}
+	return "", ErrInvalidISBN
+}
+
+// ISBN10 returns the ISBN-10 of a bare ISBN-13, or "" if it has none.
+// Only 978 numbers have one.
+func ISBN10(isbn13 string) string {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+	body := isbn13[3:12]
+	return body + string(isbn10Check(body))
+}
+
+func validISBN10(s string) bool {
+	for _, c := range s[:9] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s[9] == isbn10Check(s[:9])
+}
+
+func validISBN13(s string) bool {
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s[12] == isbn13Check(s[:12])
+}
+
+// isbn10Check computes the check digit of the first nine digits of an
+// ISBN-10: weights 10 down to 2, mod 11, with 10 written as X.
+func isbn10Check(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// isbn13Check computes the check digit of the first twelve digits of an
+// ISBN-13: alternate weights 1 and 3, mod 10.
+func isbn13Check(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,90 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OpenLibrary looks books up in the Open Library Books API. It needs no key.
+type OpenLibrary struct {
+	BaseURL string // Defaults to https://openlibrary.org
+	Client  *http.Client
+}
+
+func NewOpenLibrary() *OpenLibrary {
+	return &OpenLibrary{BaseURL: "https://openlibrary.org"}
+}
+
+type openLibraryBook struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Authors  []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Subjects []struct {
+		Name string `json:"name"`
+	} `json:"subjects"`
+	Excerpts []struct {
+		Text string `json:"text"`
+	} `json:"excerpts"`
+	Notes         json.RawMessage `json:"notes"` // A string, or {"type", "value"}
+	NumberOfPages int             `json:"number_of_pages"`
+	Cover         struct {
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+func (p *OpenLibrary) Lookup(ctx context.Context, isbn string) (Metadata, error) {
+	key := "ISBN:" + isbn
+	q := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+
+	var found map[string]openLibraryBook
+	if err := getJSON(ctx, p.Client, p.BaseURL+"/api/books?"+q.Encode(), &found); err != nil {
+		return Metadata{}, err
+	}
+	b, ok := found[key]
+	if !ok || b.Title == "" {
+		return Metadata{}, ErrNotFound
+	}
+
+	m := Metadata{
+		ISBN:      isbn,
+		Title:     joinTitle(b.Title, b.Subtitle),
+		CoverURL:  b.Cover.Large,
+		PageCount: b.NumberOfPages,
+		Source:    "openlibrary",
+	}
+	if m.CoverURL == "" {
+		m.CoverURL = b.Cover.Medium
+	}
+	var authors []string
+	for _, a := range b.Authors {
+		authors = append(authors, a.Name)
+	}
+	m.Author = strings.Join(authors, ", ")
+	for _, s := range b.Subjects {
+		m.Subjects = append(m.Subjects, s.Name)
+	}
+
+	var note struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(b.Notes, &m.Description) != nil && json.Unmarshal(b.Notes, &note) == nil {
+		m.Description = note.Value
+	}
+	if m.Description == "" && len(b.Excerpts) > 0 {
+		m.Description = b.Excerpts[0].Text
+	}
+	return m, nil
+}
+
+func joinTitle(title, subtitle string) string {
+	if subtitle == "" {
+		return title
+	}
+	return title + ": " + subtitle
+}
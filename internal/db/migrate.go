@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock key held while migrating, so
+// instances booting together don't race each other.
+const migrationLockID = 727364
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up, recorded when the migration is applied
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the migrations embedded in this package.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, path := range entries {
+		base := path[len("migrations/"):]
+		m := migrationName.FindStringSubmatch(base)
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+		version, _ := strconv.Atoi(m[1])
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(content)
+			sum := sha256.Sum256(content)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %04d at position %d", mig.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`
+	_, err := m.db.Exec(query)
+	return err
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) applied() (map[int]appliedMigration, error) {
+	rows, err := m.db.Query(`SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// withLock runs fn while holding the migration advisory lock. The lock is
+// session-scoped, so it is taken and released on one dedicated connection.
+func (m *Migrator) withLock(fn func() error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Up applies every pending migration in order. It refuses to run if an
+// applied migration's file has changed since it was applied.
+func (m *Migrator) Up() error {
+	return m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if a, ok := applied[mig.Version]; ok {
+				if a.checksum != mig.Checksum {
+					return fmt.Errorf("migration %04d_%s has changed since it was applied", mig.Version, mig.Name)
+				}
+				continue
+			}
+
+			if err := m.run(mig.Up, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, mig.Version, mig.Name, mig.Checksum); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+		}
+		return nil
+	})
+}
+
+// Down rolls back the most recent steps applied migrations.
+func (m *Migrator) Down(steps int) error {
+	return m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+
+			if err := m.run(mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+				return fmt.Errorf("rollback %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			log.Printf("Rolled back migration %04d_%s", mig.Version, mig.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration and when it was applied, if at all.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Migration: mig}
+		if a, ok := applied[mig.Version]; ok {
+			appliedAt := a.appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// run executes a migration script and its bookkeeping statement in one
+// transaction.
+func (m *Migrator) run(script, bookkeeping string, args ...interface{}) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.Version)
+		}
+		if m.Checksum == "" {
+			t.Errorf("migration %04d_%s has no checksum", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsRejectsBadSets(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"migrations/0001_init.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"gap in versions": {
+			"migrations/0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"migrations/0001_init.down.sql":  {Data: []byte("SELECT 1;")},
+			"migrations/0003_later.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/0003_later.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad file name": {
+			"migrations/init.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS books (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	author TEXT NOT NULL,
+	description TEXT,
+	genre TEXT,
+	image_path TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	user_id INTEGER REFERENCES users(id)
+);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS genre TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS image_path TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS availability TEXT NOT NULL DEFAULT 'available';
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS password_resets (
+	token TEXT PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id),
+	expiry TIMESTAMP NOT NULL
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS book_requests (
+	id SERIAL PRIMARY KEY,
+	book_id INTEGER REFERENCES books(id),
+	requester_id INTEGER REFERENCES users(id),
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(book_id, requester_id)
+);
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMPTZ;
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS declined_at TIMESTAMPTZ;
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+ALTER TABLE book_requests ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS conversations (
+	id SERIAL PRIMARY KEY,
+	request_id INTEGER UNIQUE NOT NULL REFERENCES book_requests(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	sender_id INTEGER NOT NULL REFERENCES users(id),
+	body TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	read_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS messages_conversation_id_idx ON messages (conversation_id, created_at);
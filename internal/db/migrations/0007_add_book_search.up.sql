@@ -0,0 +1,8 @@
+-- Title and author weigh most in ranking, then genre, then description.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+	setweight(to_tsvector('english', COALESCE(author, '')), 'A') ||
+	setweight(to_tsvector('english', COALESCE(genre, '')), 'B') ||
+	setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS books_search_vector_idx ON books USING GIN (search_vector);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS book_requests_requester_id_created_at_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+DROP INDEX IF EXISTS books_user_id_created_at_idx;
+DROP INDEX IF EXISTS books_created_at_id_idx;
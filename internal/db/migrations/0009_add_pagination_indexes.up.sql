@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS books_created_at_id_idx ON books (created_at, id);
+CREATE INDEX IF NOT EXISTS books_user_id_created_at_idx ON books (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS book_requests_requester_id_created_at_idx ON book_requests (requester_id, created_at, id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS isbn_lookups;
+DROP INDEX IF EXISTS books_isbn13_idx;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn10;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn13;
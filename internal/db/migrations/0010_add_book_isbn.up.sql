@@ -0,0 +1,14 @@
+-- isbn13 is the canonical form; isbn10 is kept alongside for display and is
+-- NULL for 979 numbers, which have no ISBN-10.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn13 CHAR(13);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn10 CHAR(10);
+CREATE INDEX IF NOT EXISTS books_isbn13_idx ON books (isbn13);
+
+-- Catalogue lookups by ISBN-13, so each is only fetched once. found is false
+-- for ISBNs no catalogue had.
+CREATE TABLE IF NOT EXISTS isbn_lookups (
+	isbn13 CHAR(13) PRIMARY KEY,
+	found BOOLEAN NOT NULL,
+	metadata JSONB,
+	fetched_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
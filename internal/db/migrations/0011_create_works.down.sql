@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS books_work_id_idx;
+ALTER TABLE books DROP COLUMN IF EXISTS work_id;
+DROP TABLE IF EXISTS works;
+DROP FUNCTION IF EXISTS work_key(TEXT, TEXT);
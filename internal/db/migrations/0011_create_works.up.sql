@@ -0,0 +1,37 @@
+-- work_key normalises a title and author so spellings of the same book
+-- match: case and punctuation are ignored, as is a leading article, and the
+-- author's names may come in any order ("Herbert, Frank").
+CREATE OR REPLACE FUNCTION work_key(title TEXT, author TEXT) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE AS $$
+	SELECT regexp_replace(trim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g')), '^(the|a|an) ', '')
+		|| '|' ||
+		COALESCE((SELECT string_agg(w, ' ' ORDER BY w) FROM regexp_split_to_table(lower(author), '[^[:alnum:]]+') AS w WHERE w <> ''), '')
+$$;
+
+-- A work is a book in the abstract; each books row is one copy of it.
+CREATE TABLE IF NOT EXISTS works (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	author TEXT NOT NULL,
+	isbn13 CHAR(13),
+	match_key TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS works_isbn13_idx ON works (isbn13);
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS work_id INTEGER REFERENCES works(id);
+CREATE INDEX IF NOT EXISTS books_work_id_idx ON books (work_id);
+
+-- Group the existing copies, taking each work's title and ISBN from its
+-- first copy
+INSERT INTO works (title, author, match_key)
+SELECT DISTINCT ON (work_key(title, author)) title, author, work_key(title, author)
+FROM books
+ORDER BY work_key(title, author), created_at, id
+ON CONFLICT (match_key) DO NOTHING;
+
+UPDATE books b SET work_id = w.id FROM works w WHERE w.match_key = work_key(b.title, b.author) AND b.work_id IS NULL;
+
+UPDATE works w SET isbn13 = (
+	SELECT b.isbn13 FROM books b WHERE b.work_id = w.id AND b.isbn13 IS NOT NULL ORDER BY b.created_at, b.id LIMIT 1
+) WHERE w.isbn13 IS NULL;
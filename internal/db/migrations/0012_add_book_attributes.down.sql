@@ -0,0 +1,4 @@
+ALTER TABLE books DROP COLUMN IF EXISTS page_count;
+ALTER TABLE books DROP COLUMN IF EXISTS format;
+ALTER TABLE books DROP COLUMN IF EXISTS language;
+ALTER TABLE books DROP COLUMN IF EXISTS condition;
@@ -0,0 +1,5 @@
+-- language is an ISO 639 code, e.g. "en".
+ALTER TABLE books ADD COLUMN IF NOT EXISTS condition TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS language TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS format TEXT;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS page_count INTEGER;
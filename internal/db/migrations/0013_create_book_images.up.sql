@@ -0,0 +1,15 @@
+-- A book's photos in display order. The cover's path is also kept in
+-- books.image_path, so lists don't need to join this table.
+CREATE TABLE IF NOT EXISTS book_images (
+	id SERIAL PRIMARY KEY,
+	book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+	path TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	is_cover BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS book_images_book_id_idx ON book_images (book_id, position);
+CREATE UNIQUE INDEX IF NOT EXISTS book_images_cover_idx ON book_images (book_id) WHERE is_cover;
+
+INSERT INTO book_images (book_id, path, position, is_cover)
+SELECT id, image_path, 0, true FROM books WHERE COALESCE(image_path, '') != '';
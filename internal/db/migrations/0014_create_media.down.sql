@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_avatar_path_idx;
+DROP INDEX IF EXISTS book_images_path_idx;
+DROP INDEX IF EXISTS books_image_path_idx;
+DROP TABLE IF EXISTS media;
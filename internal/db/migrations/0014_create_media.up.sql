@@ -0,0 +1,19 @@
+-- Every stored upload, so files nothing points at any more can be deleted.
+-- path is the variant books and users reference; variants lists every
+-- stored object of the upload, path included. ref_count and unreferenced_at
+-- are refreshed by each sweep.
+CREATE TABLE IF NOT EXISTS media (
+	id SERIAL PRIMARY KEY,
+	path TEXT NOT NULL UNIQUE,
+	variants TEXT[] NOT NULL,
+	owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	ref_count INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	unreferenced_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS media_unreferenced_at_idx ON media (unreferenced_at) WHERE unreferenced_at IS NOT NULL;
+
+-- Counting references looks paths up in each of these
+CREATE INDEX IF NOT EXISTS books_image_path_idx ON books (image_path);
+CREATE INDEX IF NOT EXISTS book_images_path_idx ON book_images (path);
+CREATE INDEX IF NOT EXISTS users_avatar_path_idx ON users (avatar_path);
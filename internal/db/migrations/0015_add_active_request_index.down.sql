@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS book_requests_active_idx;
+-- Keep only the latest request per member and book, as the old constraint allowed
+DELETE FROM book_requests br USING book_requests newer
+WHERE newer.book_id = br.book_id AND newer.requester_id = br.requester_id AND newer.id > br.id;
+ALTER TABLE book_requests ADD CONSTRAINT book_requests_book_id_requester_id_key UNIQUE (book_id, requester_id);
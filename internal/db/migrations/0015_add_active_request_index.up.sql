@@ -0,0 +1,6 @@
+-- A member can ask for a book again once their last request for it has
+-- ended, so only active requests need to be unique. Each request keeps its
+-- own row, timestamps and conversation.
+ALTER TABLE book_requests DROP CONSTRAINT IF EXISTS book_requests_book_id_requester_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS book_requests_active_idx ON book_requests (book_id, requester_id)
+	WHERE status IN ('pending', 'accepted');
@@ -8,7 +8,7 @@ import (
 )
 
 type EmailService interface {
-	SendRequestNotification(toEmail, ownerName, bookTitle, requesterEmail string) error
+	SendRequestNotification(toEmail, ownerName, bookTitle, requesterName string) error
 	SendPasswordReset(to, token string) error
 	SendContactEmail(fromEmail, subject, body string) error
 }
@@ -29,12 +29,12 @@ func (s *ConsoleEmailService) SendPasswordReset(to, token string) error {
 	return nil
 }
 
-func (s *ConsoleEmailService) SendRequestNotification(toEmail, ownerName, bookTitle, requesterEmail string) error {
+func (s *ConsoleEmailService) SendRequestNotification(toEmail, ownerName, bookTitle, requesterName string) error {
 	log.Printf("--------------------------------------------------")
 	log.Printf("SENDING EMAIL")
 	log.Printf("To: %s", toEmail)
 	log.Printf("Subject: New Book Request: %s", bookTitle)
-	log.Printf("Body: Hi %s,\n\nYou have a new request for your book '%s' from %s.\n\nIf you're interested in swapping, please reach out to them directly at %s to arrange a meeting place and time for the exchange.\n\nCheers,\nThe ShelfSwap Team", ownerName, bookTitle, requesterEmail, requesterEmail)
+	log.Printf("Body: Hi %s,\n\nYou have a new request for your book '%s' from %s.\n\nIf you're interested in swapping, accept the request in your ShelfSwap inbox and message them there to arrange a meeting place and time for the exchange.\n\nCheers,\nThe ShelfSwap Team", ownerName, bookTitle, requesterName)
 	log.Printf("--------------------------------------------------")
 	return nil
 }
@@ -61,13 +61,13 @@ func NewResendEmailService(apiKey string) *ResendEmailService {
 	}
 }
 
-func (s *ResendEmailService) SendRequestNotification(toEmail, ownerName, bookTitle, requesterEmail string) error {
+func (s *ResendEmailService) SendRequestNotification(toEmail, ownerName, bookTitle, requesterName string) error {
 	htmlBody := fmt.Sprintf(`
 		<p>Hi %s,</p>
 		<p>You have a new request for your book <strong><em>%s</em></strong> from <strong>%s</strong>.</p>
-		<p>If you're interested in swapping, please reach out to them directly at <a href="mailto:%s">%s</a> to arrange a convenient meeting place and time for the exchange.</p>
+		<p>If you're interested in swapping, accept the request in your ShelfSwap inbox and message them there to arrange a convenient meeting place and time for the exchange.</p>
 		<p>Cheers,<br>The ShelfSwap Team</p>
-	`, ownerName, bookTitle, requesterEmail, requesterEmail, requesterEmail)
+	`, ownerName, bookTitle, requesterName)
 
 	params := &resend.SendEmailRequest{
 		From:    "ShelfSwap Team <hello@shelfswap.io>",
@@ -0,0 +1,117 @@
+// Package imaging turns uploaded photos into the image variants the site
+// serves: it checks they really are images, drops their metadata and
+// scales them down to bounded sizes.
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Registered for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+
+	"testbook-backend/internal/apperr"
+)
+
+var (
+	ErrNotImage = apperr.BadRequest("File must be a JPEG, PNG or GIF image")
+	ErrTooLarge = apperr.BadRequest("Image dimensions are too large")
+)
+
+// maxPixels bounds the decoded size of an upload, so a small file that
+// claims to be a huge image can't exhaust memory. Processing holds two
+// full-size copies, the decoded image and its flattened RGBA, at 4 bytes a
+// pixel each.
+const maxPixels = 25_000_000
+
+// jpegQuality is the quality variants are encoded at.
+const jpegQuality = 85
+
+// Size is a variant to produce: the image scaled to fit within MaxSide
+// pixels on its longer side. Images are never scaled up.
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes are the variants made of every upload, largest first. The largest
+// is what a book's image_path points at.
+var Sizes = []Size{
+	{"large", 1600},
+	{"medium", 800},
+	{"thumb", 320},
+}
+
+// Variant is one encoded size of a processed image.
+type Variant struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+// Process reads an uploaded image and returns it re-encoded as a JPEG at
+// each of Sizes. Re-encoding drops EXIF and any other metadata, GPS
+// included; the EXIF orientation is applied to the pixels first so photos
+// stay the right way up.
+func Process(r io.Reader) ([]Variant, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	switch http.DetectContentType(head) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrNotImage
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	flat := flatten(src)
+	orientation := exifOrientation(data)
+
+	variants := make([]Variant, 0, len(Sizes))
+	for _, size := range Sizes {
+		// Turning after scaling rotates the small variant rather than
+		// another full-size copy; fit bounds both sides, so it's the same
+		img := orient(fit(flat, size.MaxSide), orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{
+			Name:        size.Name,
+			ContentType: "image/jpeg",
+			Data:        buf.Bytes(),
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+		})
+	}
+	return variants, nil
+}
+
+// flatten draws img onto white, since JPEG has no transparency.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
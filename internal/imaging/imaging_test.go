@@ -0,0 +1,111 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// withExif inserts an APP1 segment after the SOI marker of jpg, holding an
+// orientation tag and a GPS IFD pointer as phones write them.
+func withExif(jpg []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	// Orientation, SHORT, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	// GPSInfo, LONG, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8825, 4})
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPS 51.5N 0.1W")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func TestProcessJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2000, 1000))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withExif(buf.Bytes(), 6)
+	if got := exifOrientation(data); got != 6 {
+		t.Fatalf("exifOrientation = %d, want 6", got)
+	}
+
+	variants, err := Process(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != len(Sizes) {
+		t.Fatalf("got %d variants, want %d", len(variants), len(Sizes))
+	}
+
+	// Orientation 6 turns a wide photo portrait
+	want := map[string][2]int{"large": {800, 1600}, "medium": {400, 800}, "thumb": {160, 320}}
+	for _, v := range variants {
+		if got := [2]int{v.Width, v.Height}; got != want[v.Name] {
+			t.Errorf("%s is %v, want %v", v.Name, got, want[v.Name])
+		}
+		if v.ContentType != "image/jpeg" {
+			t.Errorf("%s content type = %q, want image/jpeg", v.Name, v.ContentType)
+		}
+		if bytes.Contains(v.Data, []byte("Exif")) || bytes.Contains(v.Data, []byte("GPS")) {
+			t.Errorf("%s still has its EXIF metadata", v.Name)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Errorf("%s decodes as %dx%d (%v), want %dx%d", v.Name, cfg.Width, cfg.Height, err, v.Width, v.Height)
+		}
+	}
+}
+
+func TestProcessSmallPNG(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	src.Set(0, 0, color.NRGBA{A: 0})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := Process(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Images are never scaled up
+	for _, v := range variants {
+		if v.Width != 100 || v.Height != 50 {
+			t.Errorf("%s is %dx%d, want 100x50", v.Name, v.Width, v.Height)
+		}
+	}
+}
+
+func TestProcessRejectsNonImages(t *testing.T) {
+	for name, data := range map[string]string{
+		"text":      "just some text",
+		"html":      "<html><body>hi</body></html>",
+		"truncated": "\xFF\xD8\xFF\xE0 not really a jpeg",
+	} {
+		if _, err := Process(strings.NewReader(data)); !errors.Is(err, ErrNotImage) {
+			t.Errorf("Process(%s) error = %v, want ErrNotImage", name, err)
+		}
+	}
+}
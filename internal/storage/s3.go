@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3Storage.
+type S3Config struct {
+	// Endpoint is the S3 API's base URL, e.g. https://s3.eu-west-2.amazonaws.com,
+	// https://<account>.r2.cloudflarestorage.com or http://localhost:9000.
+	// Buckets are addressed path-style, under the endpoint.
+	Endpoint  string
+	Region    string // "auto" for R2; MinIO accepts any
+	Bucket    string
+	Prefix    string // Optional key prefix, e.g. "uploads/"
+	AccessKey string
+	SecretKey string
+	// PublicURL is the base URL objects are served from, such as a CDN or
+	// an R2 public bucket domain; an object's URL is PublicURL + "/" + key.
+	// If empty, objects are served from Endpoint/Bucket, which needs a
+	// public-read bucket.
+	PublicURL string
+	Client    *http.Client // Defaults to http.DefaultClient
+}
+
+// S3Storage stores files in an S3-compatible bucket: AWS S3, Cloudflare R2,
+// MinIO and the like. Requests are signed with SigV4.
+type S3Storage struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	publicURL string
+	signer    signer
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 storage needs an endpoint and a bucket")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 storage needs an access key and a secret key")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	publicURL := strings.TrimRight(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = endpoint.String() + "/" + cfg.Bucket
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3Storage{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    strings.TrimLeft(cfg.Prefix, "/"),
+		publicURL: publicURL,
+		signer: signer{
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			region:    cfg.Region,
+			service:   "s3",
+		},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+func (s *S3Storage) Put(name, contentType string, data []byte) (string, error) {
+	if !ownsFile("/"+name, "/") {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	req, err := http.NewRequest("PUT", s.objectURL(name).String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// Names are never reused, so what's stored under one never changes
+	req.Header.Set("Cache-Control", "max-age=31536000")
+
+	hash := sha256.Sum256(data)
+	resp, err := s.do(req, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", s3Error("upload", resp)
+	}
+	return s.Path(name), nil
+}
+
+func (s *S3Storage) Path(name string) string {
+	return s.publicURL + "/" + s.prefix + name
+}
+
+func (s *S3Storage) Owns(path string) bool {
+	_, ok := s.name(path)
+	return ok
+}
+
+// name returns the file name in path, if path is one of s's public URLs.
+func (s *S3Storage) name(path string) (string, bool) {
+	prefix := s.publicURL + "/" + s.prefix
+	if !ownsFile(path, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(path, prefix), true
+}
+
+func (s *S3Storage) Open(path string) (*Object, error) {
+	name, ok := s.name(path)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	req, err := http.NewRequest("GET", s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, s3Error("open", resp)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{
+		Body:        resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ModTime:     modTime,
+	}, nil
+}
+
+func (s *S3Storage) Delete(path string) error {
+	name, ok := s.name(path)
+	if !ok {
+		return fmt.Errorf("not a file in bucket %s: %q", s.bucket, path)
+	}
+
+	req, err := http.NewRequest("DELETE", s.objectURL(name).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 whether or not the object existed
+	if resp.StatusCode != 204 && resp.StatusCode != 200 && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", resp)
+	}
+	return nil
+}
+
+// PresignGet returns a URL that reads the object at path until expires has
+// passed, for buckets that aren't public. S3 allows at most 7 days.
+func (s *S3Storage) PresignGet(path string, expires time.Duration) (string, error) {
+	name, ok := s.name(path)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s.signer.presign("GET", s.objectURL(name), nil, expires, s.now()).String(), nil
+}
+
+// PresignUpload returns a presigned PUT. The content type and length are
+// signed, so the bucket rejects any other file.
+func (s *S3Storage) PresignUpload(name, contentType string, size int64, expires time.Duration) (*DirectUpload, error) {
+	if !ownsFile("/"+name, "/") {
+		return nil, fmt.Errorf("invalid file name %q", name)
+	}
+
+	now := s.now()
+	u := s.signer.presign("PUT", s.objectURL(name), map[string]string{
+		"content-length": strconv.FormatInt(size, 10),
+		"content-type":   contentType,
+	}, expires, now)
+	return &DirectUpload{
+		Method:    "PUT",
+		URL:       u.String(),
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: now.Add(expires),
+	}, nil
+}
+
+// objectURL is the API URL of the object holding the named file.
+func (s *S3Storage) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket + "/" + s.prefix + name
+	return &u
+}
+
+// do signs and sends req.
+func (s *S3Storage) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.signer.sign(req, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+// s3Error describes a failed S3 response, whose body is an XML error
+// document with a Code and Message.
+func s3Error(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return fmt.Errorf("failed to %s file: %s: %s", action, resp.Status, string(body))
+}
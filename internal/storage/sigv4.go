@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, as S3 and the S3-compatible stores (R2, MinIO)
+// expect it. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigAlgorithm     = "AWS4-HMAC-SHA256"
+	sigDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signer signs requests for one set of credentials and region.
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// sign adds the x-amz-date, x-amz-content-sha256 and Authorization headers
+// to req. payloadHash is the hex SHA-256 of the body, or unsignedPayload.
+// Every header already set on req is signed.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(sigDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers, signed := canonicalHeaders(req)
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		headers,
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	req.Header.Set("Authorization", sigAlgorithm+
+		" Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signed+
+		", Signature="+s.signature(now, scope, canonical))
+}
+
+// presign returns u with query parameters that authorize method on it until
+// expires has passed. The host and headers, keyed by lower-case name, are
+// signed, so the request must send those header values; the payload is
+// unsigned.
+func (s signer) presign(method string, u *url.URL, headers map[string]string, expires time.Duration, now time.Time) *url.URL {
+	now = now.UTC()
+	scope := s.scope(now)
+
+	values := map[string]string{"host": u.Host}
+	for name, v := range headers {
+		values[name] = v
+	}
+	block, signed := headerBlock(values)
+
+	signedURL := *u
+	query := signedURL.Query()
+	query.Set("X-Amz-Algorithm", sigAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(sigDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signed)
+
+	canonical := strings.Join([]string{
+		method,
+		canonicalURI(u),
+		canonicalQuery(query),
+		block,
+		signed,
+		unsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, scope, canonical))
+	signedURL.RawQuery = canonicalQuery(query)
+	return &signedURL
+}
+
+// scope is the credential scope of a signature made at now.
+func (s signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature signs the string to sign built from a canonical request.
+func (s signer) signature(now time.Time, scope, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := sigAlgorithm + "\n" + now.Format(sigDateFormat) + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalHeaders returns the canonical header block of req, host
+// included, and the list of signed header names.
+func canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		values["host"] = req.Host
+	}
+	for name, vv := range req.Header {
+		trimmed := make([]string, len(vv))
+		for i, v := range vv {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	return headerBlock(values)
+}
+
+// headerBlock returns the canonical header block of values, keyed by
+// lower-case header name, and the list of signed header names.
+func headerBlock(values map[string]string) (string, string) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalURI is u's path with each segment URI-encoded once, as S3 wants.
+func canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = uriEncode(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery is query sorted by name and value, URI-encoded.
+func canonicalQuery(query url.Values) string {
+	type pair struct{ name, value string }
+	var pairs []pair
+	for name, vv := range query {
+		for _, v := range vv {
+			pairs = append(pairs, pair{uriEncode(name), uriEncode(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].name != pairs[j].name {
+			return pairs[i].name < pairs[j].name
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.name + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent-encodes everything but the RFC 3986 unreserved
+// characters, which is stricter than url.QueryEscape (it leaves no '+').
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
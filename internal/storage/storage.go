@@ -2,17 +2,69 @@ package storage
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"testbook-backend/internal/apperr"
 )
 
+// ErrNotFound is returned by Open for a path the service doesn't own or
+// has no object at.
+var ErrNotFound = apperr.NotFound("File not found")
+
 type Service interface {
-	Upload(file multipart.File, header *multipart.FileHeader) (string, error)
+	// Put stores data under name, which must be a plain file name, and
+	// returns the URL it is served from.
+	Put(name, contentType string, data []byte) (string, error)
+	// Path returns the URL a file stored under name is served from.
+	Path(name string) string
+	// Owns reports whether path is a URL this service could have returned
+	// from Put.
+	Owns(path string) bool
+	// Open returns the object stored at path, which the caller must close.
+	Open(path string) (*Object, error)
+	// Delete removes the object stored at path. Deleting an object that is
+	// already gone is not an error.
+	Delete(path string) error
+}
+
+// Object is a stored file opened for reading. Body is an io.ReadSeeker
+// when the backend supports it, so it can be served with ranges.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64 // -1 if unknown
+	ModTime     time.Time
+}
+
+func (o *Object) Close() error {
+	return o.Body.Close()
+}
+
+// DirectUpload is a signed request a client makes to store one file straight
+// into a bucket, without passing it through the API.
+type DirectUpload struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"` // Must be sent as given
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// DirectUploader is a Service clients can upload to directly.
+type DirectUploader interface {
+	Service
+	// PresignUpload authorizes a single upload of size bytes of contentType,
+	// stored under name, for about expires.
+	PresignUpload(name, contentType string, size int64, expires time.Duration) (*DirectUpload, error)
 }
 
 type SupabaseStorage struct {
@@ -29,28 +81,20 @@ func NewSupabaseStorage(projectURL, secretKey, bucket string) *SupabaseStorage {
 	}
 }
 
-func (s *SupabaseStorage) Upload(file multipart.File, header *multipart.FileHeader) (string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-
-	// Read file content
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, file); err != nil {
-		return "", err
-	}
-
+func (s *SupabaseStorage) Put(name, contentType string, data []byte) (string, error) {
 	// Create request to Supabase Storage API
 	// POST /storage/v1/object/{bucket}/{path}
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.ProjectURL, s.Bucket, filename)
-	req, err := http.NewRequest("POST", url, &buf)
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.ProjectURL, s.Bucket, name)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
 	if err != nil {
 		return "", err
 	}
 
 	// Set headers
 	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
-	req.Header.Set("Content-Type", header.Header.Get("Content-Type"))
+	req.Header.Set("Content-Type", contentType)
+	// Names are never reused, so what's stored under one never changes
+	req.Header.Set("Cache-Control", "max-age=31536000")
 
 	// Execute request
 	client := &http.Client{}
@@ -65,10 +109,144 @@ func (s *SupabaseStorage) Upload(file multipart.File, header *multipart.FileHead
 		return "", fmt.Errorf("failed to upload image: %s", string(body))
 	}
 
-	// Return public URL
+	return s.Path(name), nil
+}
+
+func (s *SupabaseStorage) Path(name string) string {
 	// GET /storage/v1/object/public/{bucket}/{path}
-	publicURL := fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.ProjectURL, s.Bucket, filename)
-	return publicURL, nil
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.ProjectURL, s.Bucket, name)
+}
+
+func (s *SupabaseStorage) Owns(path string) bool {
+	_, ok := s.name(path)
+	return ok
+}
+
+// name returns the object name in path, if path is one of s's public URLs.
+func (s *SupabaseStorage) name(path string) (string, bool) {
+	prefix := fmt.Sprintf("%s/storage/v1/object/public/%s/", s.ProjectURL, s.Bucket)
+	if !ownsFile(path, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(path, prefix), true
+}
+
+func (s *SupabaseStorage) Open(path string) (*Object, error) {
+	name, ok := s.name(path)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// GET /storage/v1/object/{bucket}/{path}
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.ProjectURL, s.Bucket, name)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		if supabaseNotFound(resp) {
+			return nil, ErrNotFound
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to open file: %s", string(body))
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{
+		Body:        resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ModTime:     modTime,
+	}, nil
+}
+
+func (s *SupabaseStorage) Delete(path string) error {
+	name, ok := s.name(path)
+	if !ok {
+		return fmt.Errorf("not a file in bucket %s: %q", s.Bucket, path)
+	}
+
+	// DELETE /storage/v1/object/{bucket}/{path}
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.ProjectURL, s.Bucket, name)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && !supabaseNotFound(resp) {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to delete file: %s", string(body))
+	}
+	return nil
+}
+
+// PresignUpload uses a Supabase signed upload URL. Supabase fixes their
+// lifetime at two hours and can't bound the size, so expires and size are
+// only advisory; the bucket's own file size limit applies.
+func (s *SupabaseStorage) PresignUpload(name, contentType string, size int64, expires time.Duration) (*DirectUpload, error) {
+	if !ownsFile("/"+name, "/") {
+		return nil, fmt.Errorf("invalid file name %q", name)
+	}
+
+	// POST /storage/v1/object/upload/sign/{bucket}/{path}
+	url := fmt.Sprintf("%s/storage/v1/object/upload/sign/%s/%s", s.ProjectURL, s.Bucket, name)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to sign upload: %s", string(body))
+	}
+	var signed struct {
+		URL string `json:"url"` // Relative to /storage/v1, with a token
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, err
+	}
+
+	return &DirectUpload{
+		Method:    "PUT",
+		URL:       s.ProjectURL + "/storage/v1" + signed.URL,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: time.Now().Add(2 * time.Hour),
+	}, nil
+}
+
+// supabaseNotFound reports whether resp says the object doesn't exist.
+// Supabase Storage answers 400 with a JSON statusCode of "404" for missing
+// objects, where a plain 404 might be expected.
+func supabaseNotFound(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusNotFound {
+		return true
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return bytes.Contains(body, []byte(`"statusCode":"404"`))
 }
 
 // LocalStorage fallback for development if needed (optional, but good practice)
@@ -80,25 +258,78 @@ func NewLocalStorage(uploadDir string) *LocalStorage {
 	return &LocalStorage{UploadDir: uploadDir}
 }
 
-func (s *LocalStorage) Upload(file multipart.File, header *multipart.FileHeader) (string, error) {
+func (s *LocalStorage) Put(name, contentType string, data []byte) (string, error) {
 	// Ensure upload directory exists
-	if _, err := os.Stat(s.UploadDir); os.IsNotExist(err) {
-		os.MkdirAll(s.UploadDir, 0755)
+	if err := os.MkdirAll(s.UploadDir, 0755); err != nil {
+		return "", err
+	}
+	if !ownsFile("/uploads/"+name, "/uploads/") {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.UploadDir, name), data, 0644); err != nil {
+		return "", err
 	}
+	return s.Path(name), nil
+}
 
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filepath := filepath.Join(s.UploadDir, filename)
+func (s *LocalStorage) Path(name string) string {
+	return "/uploads/" + name
+}
+
+func (s *LocalStorage) Owns(path string) bool {
+	return ownsFile(path, "/uploads/")
+}
 
-	dst, err := os.Create(filepath)
+func (s *LocalStorage) Open(path string) (*Object, error) {
+	if !s.Owns(path) {
+		return nil, ErrNotFound
+	}
+
+	f, err := os.Open(filepath.Join(s.UploadDir, strings.TrimPrefix(path, "/uploads/")))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, ErrNotFound
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", err
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
 	}
+	return &Object{
+		Body:        f,
+		ContentType: contentType,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(path string) error {
+	if !s.Owns(path) {
+		return fmt.Errorf("not a file in %s: %q", s.UploadDir, path)
+	}
+
+	err := os.Remove(filepath.Join(s.UploadDir, strings.TrimPrefix(path, "/uploads/")))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
 
-	return "/uploads/" + filename, nil
+// ownsFile reports whether path is prefix followed by a single plain file
+// name, as produced by Put.
+func ownsFile(path, prefix string) bool {
+	name, ok := strings.CutPrefix(path, prefix)
+	return ok && name != "" && !strings.ContainsAny(name, "/\\?#") && name != "." && name != ".."
 }
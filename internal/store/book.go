@@ -4,40 +4,132 @@ import (
 	"database/sql"
 	"strconv"
 	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+// ErrBookNotFound wraps sql.ErrNoRows so existing checks for it keep working.
+var ErrBookNotFound = apperr.NotFound("Book not found").Wrap(sql.ErrNoRows)
+
+// ErrBookReserved is returned for a change to a book's availability while one
+// of its requests is accepted.
+var ErrBookReserved = apperr.Conflict("Book is reserved for an accepted swap")
+
+type Availability string
+
+const (
+	AvailabilityAvailable Availability = "available"
+	AvailabilityReserved  Availability = "reserved"
+	AvailabilitySwapped   Availability = "swapped"
+	AvailabilityWithdrawn Availability = "withdrawn"
+
+	// AvailabilityAny disables the availability filter in BookFilter.
+	AvailabilityAny Availability = "any"
 )
 
+// Valid reports whether a is a status a book can be stored with.
+func (a Availability) Valid() bool {
+	switch a {
+	case AvailabilityAvailable, AvailabilityReserved, AvailabilitySwapped, AvailabilityWithdrawn:
+		return true
+	}
+	return false
+}
+
 type Book struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Author      string    `json:"author"`
-	Description string    `json:"description"`
-	Genre       string    `json:"genre"`
-	ImagePath   string    `json:"image_path"`
-	CreatedAt   time.Time `json:"created_at"`
-	UserID         int       `json:"user_id"`
-	UserEmail      string    `json:"user_email,omitempty"`       // For display purposes
-	UserUsername   string    `json:"user_username,omitempty"`    // For display purposes
-	UserAvatarPath string    `json:"user_avatar_path,omitempty"` // For display purposes
-	IsRequested    bool      `json:"is_requested"`
+	ID             int          `json:"id"`
+	Title          string       `json:"title"`
+	Author         string       `json:"author"`
+	Description    string       `json:"description"`
+	Genre          string       `json:"genre"`
+	ImagePath      string       `json:"image_path"`       // The cover's path
+	Images         []BookImage  `json:"images,omitempty"` // Gallery, only filled in by GetByID
+	ISBN13         string       `json:"isbn13,omitempty"`
+	ISBN10         string       `json:"isbn10,omitempty"`
+	WorkID         int          `json:"work_id,omitempty"`
+	Condition      Condition    `json:"condition,omitempty"`
+	Language       string       `json:"language,omitempty"` // ISO 639 code
+	Format         Format       `json:"format,omitempty"`
+	PageCount      int          `json:"page_count,omitempty"`
+	Availability   Availability `json:"availability"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Version        int          `json:"version"`
+	UserID         int          `json:"user_id"`
+	UserEmail      string       `json:"user_email,omitempty"`       // For display purposes
+	UserUsername   string       `json:"user_username,omitempty"`    // For display purposes
+	UserAvatarPath string       `json:"user_avatar_path,omitempty"` // For display purposes
+	UserLocation   string       `json:"user_location,omitempty"`    // For display purposes
+	IsRequested    bool         `json:"is_requested"`
+	Snippet        string       `json:"snippet,omitempty"` // Search excerpt, HTML with matches in <mark>
 }
 
 type BookFilter struct {
-	Query  string // Search by title or author
-	Genre  string // Filter by genre
-	Sort   string // "newest" or "oldest"
-	Limit  int
-	Offset int
+	Query        string       // Full-text search, see SearchQuery for the syntax
+	Genre        string       // Filter by genre
+	Location     string       // Filter by owner location
+	ISBN         string       // Filter by ISBN-13
+	WorkID       int          // Filter to copies of one work
+	Condition    Condition    // Filter by condition
+	Language     string       // Filter by language code
+	Format       Format       // Filter by format
+	Availability Availability // Filter by availability; empty means available, AvailabilityAny disables it
+	Sort         string       // "relevance", "newest" or "oldest"; searches default to relevance
+	Page         Page
+}
+
+// byRelevance reports whether results are ranked by relevance rather than
+// ordered by date.
+func (f BookFilter) byRelevance() bool {
+	return f.Sort != "oldest" && f.Sort != "newest" && !ParseSearchQuery(f.Query).Empty()
+}
+
+// bookCursor is the keyset position of a book in a date-ordered list.
+func bookCursor(b Book) Cursor {
+	return Cursor{CreatedAt: b.CreatedAt, ID: b.ID}
+}
+
+// FacetCount is how many books in a search have a given value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// BookFacets break a search down for the filter sidebar. Each facet is
+// counted with every filter but its own applied.
+type BookFacets struct {
+	Genre        []FacetCount `json:"genre"`
+	Location     []FacetCount `json:"location"`
+	Availability []FacetCount `json:"availability"`
+	Condition    []FacetCount `json:"condition"`
+	Language     []FacetCount `json:"language"`
+	Format       []FacetCount `json:"format"`
+}
+
+type BookSearchResult struct {
+	Paged[Book]
+	Fuzzy  bool       `json:"fuzzy"` // Nothing matched exactly, these are close matches
+	Facets BookFacets `json:"facets"`
 }
 
 type BookStorer interface {
 	Add(book Book) (Book, error)
-	GetAll(filter BookFilter) ([]Book, error)
+	Search(filter BookFilter) (BookSearchResult, error)
 	GetByID(id int) (Book, error)
-	GetByUserID(userID int) ([]Book, error)
+	GetByUserID(userID int, page Page) (Paged[Book], error)
 	Update(book Book) error
+	Patch(id int, patch BookPatch, version int) (Book, error)
 	Delete(id int) error
 	GetGenres() ([]string, error)
 	GetPopularGenres() ([]GenreStats, error)
+	Suggest(q string, limit int) ([]Suggestion, error)
+	GetWork(id int) (Work, error)
+	GetImages(bookID int) ([]BookImage, error)
+	AddImage(bookID int, path string, cover bool) (BookImage, error)
+	ReorderImages(bookID int, imageIDs []int) ([]BookImage, error)
+	SetCoverImage(bookID, imageID int) ([]BookImage, error)
+	RemoveImage(bookID, imageID int) error
+	GetStats() (BookStats, error)
 }
 
 type PostgresBookStore struct {
@@ -50,42 +142,32 @@ func NewPostgresBookStore(db *sql.DB) *PostgresBookStore {
 	}
 }
 
-func (s *PostgresBookStore) Migrate() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS books (
-			id SERIAL PRIMARY KEY,
-			title TEXT NOT NULL,
-			author TEXT NOT NULL,
-			description TEXT,
-			genre TEXT,
-			image_path TEXT,
-			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-			user_id INTEGER REFERENCES users(id)
-		);
-		ALTER TABLE books ADD COLUMN IF NOT EXISTS description TEXT;
-		ALTER TABLE books ADD COLUMN IF NOT EXISTS genre TEXT;
-		ALTER TABLE books ADD COLUMN IF NOT EXISTS image_path TEXT;
-		ALTER TABLE books ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
-		ALTER TABLE books ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id);
-		`
-	_, err := s.db.Exec(query)
-	return err
-}
-
 func (s *PostgresBookStore) Add(book Book) (Book, error) {
 	query := `
-		INSERT INTO books (title, author, description, genre, image_path, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at`
+		INSERT INTO books (title, author, description, genre, image_path, isbn13, isbn10, condition, language, format, page_count, availability, user_id, work_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, 0), $12, $13, $14)
+		RETURNING id, created_at, updated_at, version`
+
+	if book.Availability == "" {
+		book.Availability = AvailabilityAvailable
+	}
+
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		workID, err := resolveWork(tx, book.Title, book.Author, book.ISBN13)
+		if err != nil {
+			return err
+		}
+		book.WorkID = workID
 
-	err := s.db.QueryRow(query, book.Title, book.Author, book.Description, book.Genre, book.ImagePath, book.UserID).Scan(&book.ID, &book.CreatedAt)
+		err = tx.QueryRow(query, book.Title, book.Author, book.Description, book.Genre, book.ImagePath, book.ISBN13, book.ISBN10, book.Condition, book.Language, book.Format, book.PageCount, book.Availability, book.UserID, book.WorkID).Scan(&book.ID, &book.CreatedAt, &book.UpdatedAt, &book.Version)
+		if err != nil {
+			return err
+		}
+		if book.ImagePath != "" {
+			return syncCover(tx, book.ID, book.ImagePath)
+		}
+		return nil
+	})
 	if err != nil {
 		return Book{}, err
 	}
@@ -93,44 +175,216 @@ func (s *PostgresBookStore) Add(book Book) (Book, error) {
 	return book, nil
 }
 
-func (s *PostgresBookStore) GetAll(filter BookFilter) ([]Book, error) {
+// Search lists a page of the books matching filter, with the total number
+// of matches and facet counts for the filter sidebar. A search that finds
+// nothing is retried fuzzily, so misspelt titles and author names still
+// turn something up.
+func (s *PostgresBookStore) Search(filter BookFilter) (BookSearchResult, error) {
+	var result BookSearchResult
+	err := s.trigramTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = s.search(tx, filter)
+		return err
+	})
+	return result, err
+}
+
+// search runs Search's queries in tx.
+func (s *PostgresBookStore) search(tx *sql.Tx, filter BookFilter) (BookSearchResult, error) {
+	books, fuzzy, err := findBooks(tx, filter)
+	if err != nil {
+		return BookSearchResult{}, err
+	}
+	where := buildBookWhere(filter, fuzzy, "")
+	var total int
+	countQuery := `SELECT COUNT(*) FROM books b LEFT JOIN users u ON b.user_id = u.id` + where.sql
+	if err := tx.QueryRow(countQuery, where.args...).Scan(&total); err != nil {
+		return BookSearchResult{}, err
+	}
+	result := BookSearchResult{
+		Paged: newPaged(books, total, filter.Page, filter.byRelevance(), bookCursor),
+		Fuzzy: fuzzy,
+	}
+	if fuzzy {
+		result.Paged = markFuzzy(result.Paged)
+	}
+
+	facets := []struct {
+		name   string
+		column string
+		counts *[]FacetCount
+	}{
+		{facetGenre, "b.genre", &result.Facets.Genre},
+		{facetLocation, "u.location", &result.Facets.Location},
+		{facetAvailability, "b.availability", &result.Facets.Availability},
+		{facetCondition, "b.condition", &result.Facets.Condition},
+		{facetLanguage, "b.language", &result.Facets.Language},
+		{facetFormat, "b.format", &result.Facets.Format},
+	}
+	for _, f := range facets {
+		counts, err := facetCounts(tx, buildBookWhere(filter, fuzzy, f.name), f.column)
+		if err != nil {
+			return BookSearchResult{}, err
+		}
+		*f.counts = counts
+	}
+	return result, nil
+}
+
+// facetCounts counts the books matching where by the non-empty values of
+// column, most common first.
+func facetCounts(q queryer, where bookWhere, column string) ([]FacetCount, error) {
 	query := `
-		SELECT b.id, b.title, b.author, COALESCE(b.description, ''), COALESCE(b.genre, ''), COALESCE(b.image_path, ''), b.created_at, b.user_id, COALESCE(u.email, ''), COALESCE(u.username, ''), COALESCE(u.avatar_path, '')
+		SELECT ` + column + `, COUNT(*)
 		FROM books b
-		LEFT JOIN users u ON b.user_id = u.id
-		WHERE 1=1`
-	var args []interface{}
+		LEFT JOIN users u ON b.user_id = u.id` + where.sql + ` AND COALESCE(` + column + `, '') != ''
+		GROUP BY ` + column + `
+		ORDER BY COUNT(*) DESC, ` + column
 
-	if filter.Query != "" {
-		query += ` AND (b.title ILIKE $` + strconv.Itoa(len(args)+1) + ` OR b.author ILIKE $` + strconv.Itoa(len(args)+1) + `)`
-		args = append(args, "%"+filter.Query+"%")
+	rows, err := q.Query(query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []FacetCount{}
+	for rows.Next() {
+		var c FacetCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
 	}
+	return counts, rows.Err()
+}
 
-	if filter.Genre != "" {
-		query += ` AND b.genre = $` + strconv.Itoa(len(args)+1)
-		args = append(args, filter.Genre)
+// findBooks runs the books query, falling back to a fuzzy search if an exact
+// one finds nothing. It reports whether the fallback was used. Later pages of
+// a fallback search carry it in their cursor, since their exact query can't
+// tell an empty search from one paged past its end. Like every paged query
+// it returns one row more than the page holds.
+func findBooks(q queryer, filter BookFilter) ([]Book, bool, error) {
+	if filter.Page.After != nil && filter.Page.After.Fuzzy {
+		books, err := getBooks(q, filter, true)
+		return books, true, err
 	}
+	books, err := getBooks(q, filter, false)
+	if err != nil || len(books) > 0 || filter.Page.After != nil || ParseSearchQuery(filter.Query).Empty() {
+		return books, false, err
+	}
+	books, err = getBooks(q, filter, true)
+	return books, true, err
+}
+
+// bookWhere is the WHERE clause for a BookFilter and its arguments. The
+// search text, if any, is always $1, so rank and snippet can refer to it.
+type bookWhere struct {
+	sql     string
+	args    []interface{}
+	rank    string // Relevance expression, empty without a search
+	snippet string
+}
+
+// Facet names, for leaving a facet's own filter out when counting it.
+const (
+	facetGenre        = "genre"
+	facetLocation     = "location"
+	facetAvailability = "availability"
+	facetCondition    = "condition"
+	facetLanguage     = "language"
+	facetFormat       = "format"
+)
 
-	switch filter.Sort {
-	case "oldest":
-		query += ` ORDER BY b.created_at ASC`
-	case "newest":
-		query += ` ORDER BY b.created_at DESC`
+// buildBookWhere turns filter into a WHERE clause. With fuzzy, the search
+// matches titles and authors by trigram word similarity instead of the
+// full-text index, and must run in a trigramTx. The filter named by except is
+// left out, so a facet's counts show what choosing each of its other values
+// would give.
+func buildBookWhere(filter BookFilter, fuzzy bool, except string) bookWhere {
+	w := bookWhere{sql: ` WHERE 1=1`, snippet: `''`}
+
+	search := ParseSearchQuery(filter.Query)
+	switch {
+	case search.Empty():
+	case fuzzy:
+		// <% can use the trigram indexes; word_similarity only ranks
+		w.args = append(w.args, search.Text())
+		w.rank = `GREATEST(word_similarity($1, b.title), word_similarity($1, b.author))`
+		w.sql += ` AND ($1 <% b.title OR $1 <% b.author)`
 	default:
-		query += ` ORDER BY b.created_at DESC`
+		w.args = append(w.args, search.TSQuery())
+		w.rank = `ts_rank(b.search_vector, to_tsquery('` + searchConfig + `', $1))`
+		w.sql += ` AND b.search_vector @@ to_tsquery('` + searchConfig + `', $1)`
+		w.snippet = `ts_headline('` + searchConfig + `', COALESCE(b.description, ''), to_tsquery('` + searchConfig + `', $1), 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=15')`
+	}
+
+	if filter.Genre != "" && except != facetGenre {
+		w.sql += ` AND b.genre = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.Genre)
+	}
+
+	if filter.ISBN != "" {
+		w.sql += ` AND b.isbn13 = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.ISBN)
+	}
+
+	if filter.WorkID != 0 {
+		w.sql += ` AND b.work_id = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.WorkID)
+	}
+
+	if filter.Condition != "" && except != facetCondition {
+		w.sql += ` AND b.condition = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.Condition)
+	}
+
+	if filter.Language != "" && except != facetLanguage {
+		w.sql += ` AND b.language = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.Language)
+	}
+
+	if filter.Format != "" && except != facetFormat {
+		w.sql += ` AND b.format = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.Format)
+	}
+
+	if filter.Location != "" && except != facetLocation {
+		w.sql += ` AND u.location = $` + strconv.Itoa(len(w.args)+1)
+		w.args = append(w.args, filter.Location)
 	}
 
-	if filter.Limit > 0 {
-		query += ` LIMIT $` + strconv.Itoa(len(args)+1)
-		args = append(args, filter.Limit)
+	if except != facetAvailability {
+		switch filter.Availability {
+		case AvailabilityAny:
+		case "":
+			w.sql += ` AND b.availability = $` + strconv.Itoa(len(w.args)+1)
+			w.args = append(w.args, AvailabilityAvailable)
+		default:
+			w.sql += ` AND b.availability = $` + strconv.Itoa(len(w.args)+1)
+			w.args = append(w.args, filter.Availability)
+		}
 	}
+	return w
+}
+
+// getBooks runs one page of the books query.
+func getBooks(q queryer, filter BookFilter, fuzzy bool) ([]Book, error) {
+	where := buildBookWhere(filter, fuzzy, "")
+	args := where.args
+
+	query := `
+		SELECT b.id, b.title, b.author, COALESCE(b.description, ''), COALESCE(b.genre, ''), COALESCE(b.image_path, ''), COALESCE(b.isbn13, ''), COALESCE(b.isbn10, ''), COALESCE(b.work_id, 0), COALESCE(b.condition, ''), COALESCE(b.language, ''), COALESCE(b.format, ''), COALESCE(b.page_count, 0), b.availability, b.created_at, b.updated_at, b.version, b.user_id, COALESCE(u.email, ''), COALESCE(u.username, ''), COALESCE(u.avatar_path, ''), COALESCE(u.location, ''), ` + where.snippet + `
+		FROM books b
+		LEFT JOIN users u ON b.user_id = u.id` + where.sql
 
-	if filter.Offset > 0 {
-		query += ` OFFSET $` + strconv.Itoa(len(args)+1)
-		args = append(args, filter.Offset)
+	if filter.byRelevance() {
+		query += ` ORDER BY ` + where.rank + ` DESC, b.created_at DESC, b.id DESC`
+		query, args = filter.Page.offset(query, args)
+	} else {
+		query, args = filter.Page.keyset(query, args, "b", filter.Sort == "oldest")
 	}
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -140,12 +394,13 @@ func (s *PostgresBookStore) GetAll(filter BookFilter) ([]Book, error) {
 	for rows.Next() {
 		var b Book
 		var userID sql.NullInt64 // Handle nullable user_id for existing records
-		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description, &b.Genre, &b.ImagePath, &b.CreatedAt, &userID, &b.UserEmail, &b.UserUsername, &b.UserAvatarPath); err != nil {
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description, &b.Genre, &b.ImagePath, &b.ISBN13, &b.ISBN10, &b.WorkID, &b.Condition, &b.Language, &b.Format, &b.PageCount, &b.Availability, &b.CreatedAt, &b.UpdatedAt, &b.Version, &userID, &b.UserEmail, &b.UserUsername, &b.UserAvatarPath, &b.UserLocation, &b.Snippet); err != nil {
 			return nil, err
 		}
 		if userID.Valid {
 			b.UserID = int(userID.Int64)
 		}
+		b.Snippet = sanitizeHeadline(b.Snippet)
 		books = append(books, b)
 	}
 
@@ -155,3 +410,73 @@ func (s *PostgresBookStore) GetAll(filter BookFilter) ([]Book, error) {
 
 	return books, nil
 }
+
+// fuzzyThreshold is the trigram word similarity a title or author needs to
+// count as a fuzzy match. It is below pg_trgm's default so that one swapped
+// pair of letters in a short name ("Tolkein") still matches.
+const fuzzyThreshold = 0.3
+
+// trigramTx runs fn in a transaction with pg_trgm's word similarity
+// threshold, which the index-backed <% operator compares against, set to
+// fuzzyThreshold.
+func (s *PostgresBookStore) trigramTx(fn func(tx *sql.Tx) error) error {
+	return inTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`SET LOCAL pg_trgm.word_similarity_threshold = ` + strconv.FormatFloat(fuzzyThreshold, 'f', -1, 64)); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// Suggestion is an autocomplete entry for the search box.
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"` // "title" or "author"
+}
+
+// Suggest returns up to limit titles and authors completing q: those
+// starting with it first, then those with a word starting with it, then
+// fuzzy matches for likely misspellings. Withdrawn books are left out.
+func (s *PostgresBookStore) Suggest(q string, limit int) ([]Suggestion, error) {
+	// Parsing leaves only letters, digits and spaces, so text is safe to
+	// use in LIKE and regex patterns
+	text := ParseSearchQuery(q).Text()
+	if text == "" {
+		return []Suggestion{}, nil
+	}
+
+	query := `
+		SELECT text, kind FROM (
+			SELECT title AS text, 'title' AS kind, MAX(word_similarity($1, title)) AS score
+			FROM books WHERE availability != $4 AND (title ~* $2 OR $1 <% title)
+			GROUP BY title
+			UNION ALL
+			SELECT author, 'author', MAX(word_similarity($1, author))
+			FROM books WHERE availability != $4 AND (author ~* $2 OR $1 <% author)
+			GROUP BY author
+		) s
+		ORDER BY lower(text) LIKE $1 || '%' DESC, score DESC, text
+		LIMIT $3`
+
+	suggestions := []Suggestion{}
+	err := s.trigramTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, text, `\m`+text, limit, AvailabilityWithdrawn)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var sg Suggestion
+			if err := rows.Scan(&sg.Text, &sg.Kind); err != nil {
+				return err
+			}
+			suggestions = append(suggestions, sg)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
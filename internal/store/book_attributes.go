@@ -0,0 +1,47 @@
+package store
+
+// Condition is how worn a copy is.
+type Condition string
+
+const (
+	ConditionNew     Condition = "new"
+	ConditionLikeNew Condition = "like_new"
+	ConditionGood    Condition = "good"
+	ConditionFair    Condition = "fair"
+	ConditionPoor    Condition = "poor"
+)
+
+// Conditions lists every condition, best first.
+var Conditions = []Condition{ConditionNew, ConditionLikeNew, ConditionGood, ConditionFair, ConditionPoor}
+
+// Valid reports whether c is a condition a book can be stored with.
+func (c Condition) Valid() bool {
+	for _, v := range Conditions {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Format is what a copy physically is.
+type Format string
+
+const (
+	FormatPaperback Format = "paperback"
+	FormatHardcover Format = "hardcover"
+	FormatEbookCode Format = "ebook_code" // A redeemable code for an ebook
+	FormatAudiobook Format = "audiobook"
+)
+
+var Formats = []Format{FormatPaperback, FormatHardcover, FormatEbookCode, FormatAudiobook}
+
+// Valid reports whether f is a format a book can be stored with.
+func (f Format) Valid() bool {
+	for _, v := range Formats {
+		if f == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,5 +1,26 @@
 package store
 
+// Genres is the fixed list of genres a book can be filed under.
+var Genres = []string{
+	"Biography",
+	"Children",
+	"Classics",
+	"Comics",
+	"Fantasy",
+	"Fiction",
+	"History",
+	"Horror",
+	"Mystery",
+	"Non-Fiction",
+	"Poetry",
+	"Romance",
+	"Science",
+	"Science Fiction",
+	"Self-Help",
+	"Thriller",
+	"Young Adult",
+}
+
 func (s *PostgresBookStore) GetGenres() ([]string, error) {
 	query := `SELECT DISTINCT genre FROM books WHERE genre IS NOT NULL AND genre != '' ORDER BY genre ASC`
 	rows, err := s.db.Query(query)
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+// MaxBookImages is how many photos a book can have.
+const MaxBookImages = 10
+
+var (
+	ErrImageNotFound = apperr.NotFound("Image not found")
+	ErrTooManyImages = apperr.Conflict("A book can have at most 10 images")
+	ErrImageOrder    = apperr.BadRequest("Image order must list each of the book's images once")
+)
+
+// BookImage is one photo in a book's gallery. The cover is the one shown in
+// lists; its path is the book's ImagePath.
+type BookImage struct {
+	ID        int       `json:"id"`
+	BookID    int       `json:"book_id"`
+	Path      string    `json:"path"`
+	Position  int       `json:"position"`
+	IsCover   bool      `json:"is_cover"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *PostgresBookStore) GetImages(bookID int) ([]BookImage, error) {
+	return getImages(s.db, bookID)
+}
+
+func getImages(q queryer, bookID int) ([]BookImage, error) {
+	rows, err := q.Query(`
+		SELECT id, book_id, path, position, is_cover, created_at
+		FROM book_images
+		WHERE book_id = $1
+		ORDER BY position, id`, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []BookImage{}
+	for rows.Next() {
+		var img BookImage
+		if err := rows.Scan(&img.ID, &img.BookID, &img.Path, &img.Position, &img.IsCover, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddImage appends an image to a book's gallery. It becomes the cover if
+// cover is set or it's the first image.
+func (s *PostgresBookStore) AddImage(bookID int, path string, cover bool) (BookImage, error) {
+	var img BookImage
+	err := s.galleryTx(bookID, func(tx *sql.Tx, images []BookImage) error {
+		if len(images) >= MaxBookImages {
+			return ErrTooManyImages
+		}
+		cover = cover || len(images) == 0
+		if cover {
+			if _, err := tx.Exec(`UPDATE book_images SET is_cover = false WHERE book_id = $1 AND is_cover`, bookID); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRow(`
+			INSERT INTO book_images (book_id, path, position, is_cover)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, book_id, path, position, is_cover, created_at`,
+			bookID, path, nextPosition(images), cover,
+		).Scan(&img.ID, &img.BookID, &img.Path, &img.Position, &img.IsCover, &img.CreatedAt)
+	})
+	return img, err
+}
+
+// ReorderImages puts a book's images in the order of imageIDs, which must
+// list each of them exactly once.
+func (s *PostgresBookStore) ReorderImages(bookID int, imageIDs []int) ([]BookImage, error) {
+	err := s.galleryTx(bookID, func(tx *sql.Tx, images []BookImage) error {
+		if !sameImages(images, imageIDs) {
+			return ErrImageOrder
+		}
+		for i, id := range imageIDs {
+			if _, err := tx.Exec(`UPDATE book_images SET position = $1 WHERE id = $2`, i, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetImages(bookID)
+}
+
+// SetCoverImage makes one of a book's images its cover.
+func (s *PostgresBookStore) SetCoverImage(bookID, imageID int) ([]BookImage, error) {
+	err := s.galleryTx(bookID, func(tx *sql.Tx, images []BookImage) error {
+		if findImage(images, imageID) < 0 {
+			return ErrImageNotFound
+		}
+		return setCover(tx, bookID, imageID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetImages(bookID)
+}
+
+// RemoveImage deletes an image from a book's gallery. If it was the cover,
+// the first remaining image takes over.
+func (s *PostgresBookStore) RemoveImage(bookID, imageID int) error {
+	return s.galleryTx(bookID, func(tx *sql.Tx, images []BookImage) error {
+		i := findImage(images, imageID)
+		if i < 0 {
+			return ErrImageNotFound
+		}
+		if _, err := tx.Exec(`DELETE FROM book_images WHERE id = $1`, imageID); err != nil {
+			return err
+		}
+		if images[i].IsCover && len(images) > 1 {
+			next := images[0]
+			if i == 0 {
+				next = images[1]
+			}
+			return setCover(tx, bookID, next.ID)
+		}
+		return nil
+	})
+}
+
+// galleryTx runs fn on a book's gallery in a transaction, with the book
+// locked so concurrent edits queue up. Afterwards the book's image_path is
+// set to the cover and its version bumped.
+func (s *PostgresBookStore) galleryTx(bookID int, fn func(tx *sql.Tx, images []BookImage) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`SELECT id FROM books WHERE id = $1 FOR UPDATE`, bookID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	images, err := getImages(tx, bookID)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx, images); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE books
+		SET image_path = COALESCE((SELECT path FROM book_images WHERE book_id = $1 AND is_cover), ''),
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, bookID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setCover(q queryer, bookID, imageID int) error {
+	if _, err := q.Exec(`UPDATE book_images SET is_cover = false WHERE book_id = $1 AND is_cover AND id != $2`, bookID, imageID); err != nil {
+		return err
+	}
+	_, err := q.Exec(`UPDATE book_images SET is_cover = true WHERE id = $1`, imageID)
+	return err
+}
+
+// syncCover brings the gallery in line after a book's image_path was
+// written directly: a path already in the gallery becomes the cover, a new
+// one replaces the cover's photo, and an empty path leaves the book without
+// a cover. Without a cover to replace, a new path joins the gallery if it
+// has room.
+func syncCover(q queryer, bookID int, path string) error {
+	if path == "" {
+		_, err := q.Exec(`UPDATE book_images SET is_cover = false WHERE book_id = $1 AND is_cover`, bookID)
+		return err
+	}
+
+	images, err := getImages(q, bookID)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if img.Path == path {
+			return setCover(q, bookID, img.ID)
+		}
+	}
+	for _, img := range images {
+		if img.IsCover {
+			_, err := q.Exec(`UPDATE book_images SET path = $1 WHERE id = $2`, path, img.ID)
+			return err
+		}
+	}
+	if len(images) >= MaxBookImages {
+		return ErrTooManyImages
+	}
+	_, err = q.Exec(`INSERT INTO book_images (book_id, path, position, is_cover) VALUES ($1, $2, $3, true)`, bookID, path, nextPosition(images))
+	return err
+}
+
+func nextPosition(images []BookImage) int {
+	if len(images) == 0 {
+		return 0
+	}
+	return images[len(images)-1].Position + 1
+}
+
+func findImage(images []BookImage, id int) int {
+	for i, img := range images {
+		if img.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameImages reports whether ids lists each image exactly once.
+func sameImages(images []BookImage, ids []int) bool {
+	if len(ids) != len(images) {
+		return false
+	}
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] || findImage(images, id) < 0 {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInMemoryGallery(t *testing.T) {
+	s := NewInMemoryBookStore()
+	book, err := s.Add(Book{Title: "Emma", Author: "Jane Austen", ImagePath: "/uploads/front.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spine, err := s.AddImage(book.ID, "/uploads/spine.jpg", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := s.AddImage(book.ID, "/uploads/pages.jpg", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spine.IsCover || pages.IsCover {
+		t.Error("added images took over the cover")
+	}
+
+	paths := func() []string {
+		t.Helper()
+		b, err := s.GetByID(book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, img := range b.Images {
+			p := img.Path
+			if img.IsCover {
+				p += "*"
+				if b.ImagePath != img.Path {
+					t.Errorf("ImagePath = %q, want the cover %q", b.ImagePath, img.Path)
+				}
+			}
+			paths = append(paths, p)
+		}
+		return paths
+	}
+	if got, want := paths(), []string{"/uploads/front.jpg*", "/uploads/spine.jpg", "/uploads/pages.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gallery = %v, want %v", got, want)
+	}
+
+	front := spine.ID - 1
+	if _, err := s.ReorderImages(book.ID, []int{pages.ID, front, spine.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReorderImages(book.ID, []int{pages.ID, front}); err != ErrImageOrder {
+		t.Errorf("reorder missing an image: error = %v, want ErrImageOrder", err)
+	}
+	if _, err := s.SetCoverImage(book.ID, spine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(), []string{"/uploads/pages.jpg", "/uploads/front.jpg", "/uploads/spine.jpg*"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gallery = %v, want %v", got, want)
+	}
+
+	// Removing the cover hands it to the first image left
+	if err := s.RemoveImage(book.ID, spine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(), []string{"/uploads/pages.jpg*", "/uploads/front.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gallery = %v, want %v", got, want)
+	}
+	if err := s.RemoveImage(book.ID, spine.ID); err != ErrImageNotFound {
+		t.Errorf("removing twice: error = %v, want ErrImageNotFound", err)
+	}
+
+	if back, err := s.AddImage(book.ID, "/uploads/back.jpg", true); err != nil || !back.IsCover {
+		t.Fatalf("AddImage as cover = %+v, %v", back, err)
+	}
+	if got, want := paths(), []string{"/uploads/pages.jpg", "/uploads/front.jpg", "/uploads/back.jpg*"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gallery = %v, want %v", got, want)
+	}
+}
+
+func TestInMemorySyncCover(t *testing.T) {
+	s := NewInMemoryBookStore()
+	book, err := s.Add(Book{Title: "Emma", Author: "Jane Austen", ImagePath: "/uploads/front.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(book.Images) < MaxBookImages {
+		if _, err := s.AddImage(book.ID, "/uploads/more.jpg", false); err != nil {
+			t.Fatal(err)
+		}
+		if book, err = s.GetByID(book.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new image_path replaces the cover's photo rather than growing a
+	// full gallery
+	path := "/uploads/new.jpg"
+	if _, err := s.Patch(book.ID, BookPatch{ImagePath: &path}, 0); err != nil {
+		t.Fatal(err)
+	}
+	book, _ = s.GetByID(book.ID)
+	if len(book.Images) != MaxBookImages || book.Images[0].Path != "/uploads/new.jpg" || !book.Images[0].IsCover {
+		t.Errorf("gallery = %+v, want the cover's photo replaced", book.Images)
+	}
+
+	// Without a cover to replace, a full gallery has no room for another
+	book.ImagePath = ""
+	if err := s.Update(book); err != nil {
+		t.Fatal(err)
+	}
+	book.ImagePath = "/uploads/other.jpg"
+	if err := s.Update(book); err != ErrTooManyImages {
+		t.Errorf("Update with a full gallery: error = %v, want ErrTooManyImages", err)
+	}
+	if book, _ = s.GetByID(book.ID); book.ImagePath != "" {
+		t.Errorf("ImagePath = %q after a rejected update, want it left empty", book.ImagePath)
+	}
+}
@@ -4,54 +4,107 @@ import "database/sql"
 
 func (s *PostgresBookStore) GetByID(id int) (Book, error) {
 	query := `
-		SELECT b.id, b.title, b.author, COALESCE(b.description, ''), COALESCE(b.genre, ''), COALESCE(b.image_path, ''), b.created_at, b.user_id, COALESCE(u.email, ''), COALESCE(u.username, ''), COALESCE(u.avatar_path, '')
+		SELECT b.id, b.title, b.author, COALESCE(b.description, ''), COALESCE(b.genre, ''), COALESCE(b.image_path, ''), COALESCE(b.isbn13, ''), COALESCE(b.isbn10, ''), COALESCE(b.work_id, 0), COALESCE(b.condition, ''), COALESCE(b.language, ''), COALESCE(b.format, ''), COALESCE(b.page_count, 0), b.availability, b.created_at, b.updated_at, b.version, b.user_id, COALESCE(u.email, ''), COALESCE(u.username, ''), COALESCE(u.avatar_path, ''), COALESCE(u.location, '')
 		FROM books b
 		LEFT JOIN users u ON b.user_id = u.id
 		WHERE b.id = $1`
 	var book Book
 	var userID sql.NullInt64
-	err := s.db.QueryRow(query, id).Scan(&book.ID, &book.Title, &book.Author, &book.Description, &book.Genre, &book.ImagePath, &book.CreatedAt, &userID, &book.UserEmail, &book.UserUsername, &book.UserAvatarPath)
+	err := s.db.QueryRow(query, id).Scan(&book.ID, &book.Title, &book.Author, &book.Description, &book.Genre, &book.ImagePath, &book.ISBN13, &book.ISBN10, &book.WorkID, &book.Condition, &book.Language, &book.Format, &book.PageCount, &book.Availability, &book.CreatedAt, &book.UpdatedAt, &book.Version, &userID, &book.UserEmail, &book.UserUsername, &book.UserAvatarPath, &book.UserLocation)
+	if err == sql.ErrNoRows {
+		return Book{}, ErrBookNotFound
+	}
 	if err != nil {
 		return Book{}, err
 	}
 	if userID.Valid {
 		book.UserID = int(userID.Int64)
 	}
+	if book.Images, err = s.GetImages(id); err != nil {
+		return Book{}, err
+	}
 	return book, nil
 }
 
-func (s *PostgresBookStore) GetByUserID(userID int) ([]Book, error) {
-	query := `
-		SELECT id, title, author, COALESCE(description, ''), COALESCE(image_path, ''), created_at, user_id
-		FROM books
-		WHERE user_id = $1
-		ORDER BY created_at DESC`
+func (s *PostgresBookStore) GetByUserID(userID int, page Page) (Paged[Book], error) {
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM books WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return Paged[Book]{}, err
+	}
 
-	rows, err := s.db.Query(query, userID)
+	query, args := page.keyset(`
+		SELECT b.id, b.title, b.author, COALESCE(b.description, ''), COALESCE(b.image_path, ''), COALESCE(b.isbn13, ''), COALESCE(b.isbn10, ''), COALESCE(b.work_id, 0), COALESCE(b.condition, ''), COALESCE(b.language, ''), COALESCE(b.format, ''), COALESCE(b.page_count, 0), b.availability, b.created_at, b.updated_at, b.version, b.user_id
+		FROM books b
+		WHERE b.user_id = $1`, []interface{}{userID}, "b", false)
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return Paged[Book]{}, err
 	}
 	defer rows.Close()
 
 	books := []Book{}
 	for rows.Next() {
 		var b Book
-		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description, &b.ImagePath, &b.CreatedAt, &b.UserID); err != nil {
-			return nil, err
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Description, &b.ImagePath, &b.ISBN13, &b.ISBN10, &b.WorkID, &b.Condition, &b.Language, &b.Format, &b.PageCount, &b.Availability, &b.CreatedAt, &b.UpdatedAt, &b.Version, &b.UserID); err != nil {
+			return Paged[Book]{}, err
 		}
 		books = append(books, b)
 	}
-	return books, nil
+	if err := rows.Err(); err != nil {
+		return Paged[Book]{}, err
+	}
+	return newPaged(books, total, page, false, bookCursor), nil
 }
 
 func (s *PostgresBookStore) Update(book Book) error {
-	query := `UPDATE books SET title = $1, author = $2, description = $3, genre = $4, image_path = $5 WHERE id = $6`
-	_, err := s.db.Exec(query, book.Title, book.Author, book.Description, book.Genre, book.ImagePath, book.ID)
-	return err
+	query := `UPDATE books SET title = $1, author = $2, description = $3, genre = $4, image_path = $5, isbn13 = NULLIF($6, ''), isbn10 = NULLIF($7, ''), condition = NULLIF($8, ''), language = NULLIF($9, ''), format = NULLIF($10, ''), page_count = NULLIF($11, 0), availability = $12, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $13`
+	return inTx(s.db, func(tx *sql.Tx) error {
+		if err := lockAvailability(tx, book.ID, book.Availability); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, book.Title, book.Author, book.Description, book.Genre, book.ImagePath, book.ISBN13, book.ISBN10, book.Condition, book.Language, book.Format, book.PageCount, book.Availability, book.ID); err != nil {
+			return err
+		}
+		if err := syncCover(tx, book.ID, book.ImagePath); err != nil {
+			return err
+		}
+		return relinkWork(tx, book.ID)
+	})
 }
 
+// lockAvailability locks book id ahead of setting its availability, and
+// returns ErrBookReserved if that would change it while one of the book's
+// requests is accepted. Accepting a request locks the book too, so the two
+// can't interleave.
+func lockAvailability(tx *sql.Tx, id int, availability Availability) error {
+	var current Availability
+	var accepted bool
+	err := tx.QueryRow(`
+		SELECT availability, EXISTS(SELECT 1 FROM book_requests WHERE book_id = books.id AND status = $2)
+		FROM books WHERE id = $1
+		FOR UPDATE`, id, RequestAccepted).Scan(&current, &accepted)
+	if err == sql.ErrNoRows {
+		return ErrBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if accepted && current != availability {
+		return ErrBookReserved
+	}
+	return nil
+}
+
+// Delete removes a book together with the requests made for it, which
+// would otherwise block it by foreign key. Their conversations and the
+// book's gallery cascade.
 func (s *PostgresBookStore) Delete(id int) error {
-	query := `DELETE FROM books WHERE id = $1`
-	_, err := s.db.Exec(query, id)
-	return err
+	return inTx(s.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM book_requests WHERE book_id = $1`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM books WHERE id = $1`, id)
+		return err
+	})
 }
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"database/sql"
+
+	"testbook-backend/internal/catalog"
+)
+
+// BookPatch lists the fields of a book to change. Nil fields are left as
+// they are.
+type BookPatch struct {
+	Title        *string
+	Author       *string
+	Description  *string
+	Genre        *string
+	ImagePath    *string
+	ISBN         *string // ISBN-13, or "" to remove it; the ISBN-10 follows
+	Condition    *Condition
+	Language     *string
+	Format       *Format
+	PageCount    *int // 0 removes it
+	Availability *Availability
+}
+
+// Apply returns book with the patch's fields written over it.
+func (p BookPatch) Apply(book Book) Book {
+	setIf(&book.Title, p.Title)
+	setIf(&book.Author, p.Author)
+	setIf(&book.Description, p.Description)
+	setIf(&book.Genre, p.Genre)
+	setIf(&book.ImagePath, p.ImagePath)
+	if p.ISBN != nil {
+		book.ISBN13, book.ISBN10 = *p.ISBN, catalog.ISBN10(*p.ISBN)
+	}
+	setIf(&book.Condition, p.Condition)
+	setIf(&book.Language, p.Language)
+	setIf(&book.Format, p.Format)
+	setIf(&book.PageCount, p.PageCount)
+	setIf(&book.Availability, p.Availability)
+	return book
+}
+
+// Patch updates only the fields set in patch. If version is above zero the
+// update only goes through while the book is still at that version.
+func (s *PostgresBookStore) Patch(id int, patch BookPatch, version int) (Book, error) {
+	update := patchUpdate{table: "books"}
+	if patch.Title != nil {
+		update.set("title", *patch.Title)
+	}
+	if patch.Author != nil {
+		update.set("author", *patch.Author)
+	}
+	if patch.Description != nil {
+		update.set("description", *patch.Description)
+	}
+	if patch.Genre != nil {
+		update.set("genre", *patch.Genre)
+	}
+	if patch.ImagePath != nil {
+		update.set("image_path", *patch.ImagePath)
+	}
+	if patch.ISBN != nil {
+		update.set("isbn13", sql.NullString{String: *patch.ISBN, Valid: *patch.ISBN != ""})
+		isbn10 := catalog.ISBN10(*patch.ISBN)
+		update.set("isbn10", sql.NullString{String: isbn10, Valid: isbn10 != ""})
+	}
+	if patch.Condition != nil {
+		update.set("condition", sql.NullString{String: string(*patch.Condition), Valid: *patch.Condition != ""})
+	}
+	if patch.Language != nil {
+		update.set("language", sql.NullString{String: *patch.Language, Valid: *patch.Language != ""})
+	}
+	if patch.Format != nil {
+		update.set("format", sql.NullString{String: string(*patch.Format), Valid: *patch.Format != ""})
+	}
+	if patch.PageCount != nil {
+		update.set("page_count", sql.NullInt64{Int64: int64(*patch.PageCount), Valid: *patch.PageCount != 0})
+	}
+	if patch.Availability != nil {
+		update.set("availability", *patch.Availability)
+	}
+
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		if patch.Availability != nil {
+			if err := lockAvailability(tx, id, *patch.Availability); err != nil {
+				return err
+			}
+		}
+		if err := update.exec(tx, id, version, ErrBookNotFound); err != nil {
+			return err
+		}
+		if patch.ImagePath != nil {
+			if err := syncCover(tx, id, *patch.ImagePath); err != nil {
+				return err
+			}
+		}
+		if patch.Title != nil || patch.Author != nil || patch.ISBN != nil {
+			return relinkWork(tx, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return Book{}, err
+	}
+	return s.GetByID(id)
+}
+
+func setIf[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
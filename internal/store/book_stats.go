@@ -0,0 +1,16 @@
+package store
+
+// BookStats are the site-wide totals shown on the landing page.
+type BookStats struct {
+	TotalBooks  int `json:"total_books"`
+	ActiveUsers int `json:"active_users"` // Members with at least one book
+	TotalGenres int `json:"total_genres"`
+	TotalWorks  int `json:"total_works"` // Distinct books, however many copies each has
+}
+
+func (s *PostgresBookStore) GetStats() (BookStats, error) {
+	query := `SELECT COUNT(*), COUNT(DISTINCT user_id), COUNT(DISTINCT NULLIF(genre, '')), COUNT(DISTINCT work_id) FROM books`
+	var stats BookStats
+	err := s.db.QueryRow(query).Scan(&stats.TotalBooks, &stats.ActiveUsers, &stats.TotalGenres, &stats.TotalWorks)
+	return stats, err
+}
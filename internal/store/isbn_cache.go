@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+
+	"testbook-backend/internal/catalog"
+)
+
+// PostgresISBNCache keeps catalogue lookups in the isbn_lookups table.
+type PostgresISBNCache struct {
+	db *sql.DB
+}
+
+func NewPostgresISBNCache(db *sql.DB) *PostgresISBNCache {
+	return &PostgresISBNCache{db: db}
+}
+
+func (c *PostgresISBNCache) GetLookup(isbn string) (catalog.CacheEntry, bool, error) {
+	var entry catalog.CacheEntry
+	var metadata []byte
+	err := c.db.QueryRow(`SELECT found, metadata, fetched_at FROM isbn_lookups WHERE isbn13 = $1`, isbn).Scan(&entry.Found, &metadata, &entry.FetchedAt)
+	if err == sql.ErrNoRows {
+		return catalog.CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return catalog.CacheEntry{}, false, err
+	}
+	if metadata != nil {
+		if err := json.Unmarshal(metadata, &entry.Metadata); err != nil {
+			return catalog.CacheEntry{}, false, err
+		}
+	}
+	return entry, true, nil
+}
+
+func (c *PostgresISBNCache) PutLookup(isbn string, entry catalog.CacheEntry) error {
+	var metadata []byte
+	if entry.Found {
+		var err error
+		if metadata, err = json.Marshal(entry.Metadata); err != nil {
+			return err
+		}
+	}
+	_, err := c.db.Exec(`
+		INSERT INTO isbn_lookups (isbn13, found, metadata, fetched_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (isbn13) DO UPDATE SET found = EXCLUDED.found, metadata = EXCLUDED.metadata, fetched_at = EXCLUDED.fetched_at`,
+		isbn, entry.Found, metadata, entry.FetchedAt)
+	return err
+}
+
+type InMemoryISBNCache struct {
+	mu      sync.Mutex
+	entries map[string]catalog.CacheEntry
+}
+
+func NewInMemoryISBNCache() *InMemoryISBNCache {
+	return &InMemoryISBNCache{entries: make(map[string]catalog.CacheEntry)}
+}
+
+func (c *InMemoryISBNCache) GetLookup(isbn string) (catalog.CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[isbn]
+	return entry, ok, nil
+}
+
+func (c *InMemoryISBNCache) PutLookup(isbn string, entry catalog.CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[isbn] = entry
+	return nil
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Media is one stored upload. Books and users point at Path; Variants are
+// all the objects stored for it, Path included, and go when it does.
+type Media struct {
+	ID       int      `json:"id"`
+	Path     string   `json:"path"`
+	Variants []string `json:"variants"`
+	OwnerID  int      `json:"owner_id,omitempty"`
+	// RefCount is how many book covers, gallery images and avatars pointed
+	// at Path when references were last counted.
+	RefCount  int       `json:"ref_count"`
+	CreatedAt time.Time `json:"created_at"`
+	// UnreferencedAt is when nothing was first seen pointing at Path, or nil
+	// if something does.
+	UnreferencedAt *time.Time `json:"unreferenced_at,omitempty"`
+}
+
+type MediaStore interface {
+	// Add records an upload. It starts out unreferenced.
+	Add(media Media) (Media, error)
+	// Unreferenced counts every upload's references as of now, then returns
+	// up to limit uploads nothing has pointed at since before cutoff, oldest
+	// first.
+	Unreferenced(now, cutoff time.Time, limit int) ([]Media, error)
+	// Delete forgets an upload unless something points at it again, and
+	// reports whether it did.
+	Delete(id int) (bool, error)
+}
+
+type PostgresMediaStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMediaStore(db *sql.DB) *PostgresMediaStore {
+	return &PostgresMediaStore{db: db}
+}
+
+// mediaRefs counts the references to m.path, for use in queries over media m.
+const mediaRefs = `(
+	(SELECT count(*) FROM books WHERE image_path = m.path) +
+	(SELECT count(*) FROM book_images WHERE path = m.path) +
+	(SELECT count(*) FROM users WHERE avatar_path = m.path))`
+
+func (s *PostgresMediaStore) Add(media Media) (Media, error) {
+	var ownerID sql.NullInt64
+	if media.OwnerID != 0 {
+		ownerID = sql.NullInt64{Int64: int64(media.OwnerID), Valid: true}
+	}
+	err := s.db.QueryRow(`
+		INSERT INTO media (path, variants, owner_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, ref_count, created_at, unreferenced_at`,
+		media.Path, pq.Array(media.Variants), ownerID,
+	).Scan(&media.ID, &media.RefCount, &media.CreatedAt, &media.UnreferencedAt)
+	return media, err
+}
+
+func (s *PostgresMediaStore) Unreferenced(now, cutoff time.Time, limit int) ([]Media, error) {
+	_, err := s.db.Exec(`
+		UPDATE media SET
+			ref_count = refs.n,
+			unreferenced_at = CASE WHEN refs.n > 0 THEN NULL ELSE COALESCE(media.unreferenced_at, $1) END
+		FROM (SELECT m.id, `+mediaRefs+` AS n FROM media m) refs
+		WHERE refs.id = media.id`, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, path, variants, COALESCE(owner_id, 0), ref_count, created_at, unreferenced_at
+		FROM media
+		WHERE unreferenced_at < $1
+		ORDER BY unreferenced_at, id
+		LIMIT $2`, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		if err := rows.Scan(&m.ID, &m.Path, pq.Array(&m.Variants), &m.OwnerID, &m.RefCount, &m.CreatedAt, &m.UnreferencedAt); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+func (s *PostgresMediaStore) Delete(id int) (bool, error) {
+	// Count again: a book or user may have taken the upload since the sweep
+	// listed it
+	result, err := s.db.Exec(`DELETE FROM media m WHERE id = $1 AND `+mediaRefs+` = 0`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
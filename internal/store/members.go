@@ -1,33 +1,45 @@
 package store
 
-func (s *PostgresUserStore) GetMembers(searchQuery string) ([]User, error) {
-	query := `
-		SELECT id, email, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at
-		FROM users`
+// userCursor is the keyset position of a user in the members list.
+func userCursor(u User) Cursor {
+	return Cursor{CreatedAt: u.CreatedAt, ID: u.ID}
+}
 
+func (s *PostgresUserStore) GetMembers(searchQuery string, page Page) (Paged[User], error) {
+	where := ` WHERE 1=1`
 	var args []interface{}
 
 	// Add WHERE clause if search query is provided
 	if searchQuery != "" {
-		query += ` WHERE username ILIKE $1`
+		where += ` AND u.username ILIKE $1`
 		args = append(args, "%"+searchQuery+"%")
 	}
 
-	query += ` ORDER BY created_at DESC`
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM users u`+where, args...).Scan(&total); err != nil {
+		return Paged[User]{}, err
+	}
+
+	query, args := page.keyset(`
+		SELECT u.id, u.email, COALESCE(u.username, ''), COALESCE(u.bio, ''), COALESCE(u.avatar_path, ''), COALESCE(u.location, ''), u.created_at, u.updated_at, u.version
+		FROM users u`+where, args, "u", false)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return Paged[User]{}, err
 	}
 	defer rows.Close()
 
 	var members []User
 	for rows.Next() {
 		var u User
-		if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.Bio, &u.AvatarPath, &u.Location, &u.CreatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&u.ID, &u.Email, &u.Username, &u.Bio, &u.AvatarPath, &u.Location, &u.CreatedAt, &u.UpdatedAt, &u.Version); err != nil {
+			return Paged[User]{}, err
 		}
 		members = append(members, u)
 	}
-	return members, nil
+	if err := rows.Err(); err != nil {
+		return Paged[User]{}, err
+	}
+	return newPaged(members, total, page, false, userCursor), nil
 }
@@ -4,17 +4,22 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type InMemoryBookStore struct {
-	mu     sync.Mutex
-	books  []Book
-	nextID int
+	mu          sync.Mutex
+	books       []Book
+	works       []Work
+	images      []BookImage
+	nextID      int
+	nextImageID int
 }
 
 func NewInMemoryBookStore() *InMemoryBookStore {
 	return &InMemoryBookStore{
 		books:  []Book{},
+		works:  []Work{},
 		nextID: 1,
 	}
 }
@@ -25,31 +30,204 @@ func (s *InMemoryBookStore) Add(book Book) (Book, error) {
 
 	book.ID = s.nextID
 	s.nextID++
+	if book.Availability == "" {
+		book.Availability = AvailabilityAvailable
+	}
+	if book.CreatedAt.IsZero() {
+		book.CreatedAt = time.Now()
+	}
+	book.UpdatedAt = time.Now()
+	book.Version = 1
+	book.WorkID = s.resolveWork(book)
+	if err := s.syncCover(book.ID, book.ImagePath); err != nil {
+		return Book{}, err
+	}
 	s.books = append(s.books, book)
 	return book, nil
 }
 
-func (s *InMemoryBookStore) GetAll(filter BookFilter) ([]Book, error) {
+func (s *InMemoryBookStore) Search(filter BookFilter) (BookSearchResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	books, fuzzy := s.find(filter)
+	result := BookSearchResult{
+		Paged: pageSlice(books, filter.Page, filter.byRelevance(), filter.Sort == "oldest", bookCursor),
+		Fuzzy: fuzzy,
+	}
+	if fuzzy {
+		result.Paged = markFuzzy(result.Paged)
+	}
+	result.Facets.Genre = countFacet(s.search(filter, fuzzy, facetGenre), func(b Book) string { return b.Genre })
+	result.Facets.Location = countFacet(s.search(filter, fuzzy, facetLocation), func(b Book) string { return b.UserLocation })
+	result.Facets.Availability = countFacet(s.search(filter, fuzzy, facetAvailability), func(b Book) string { return string(b.Availability) })
+	result.Facets.Condition = countFacet(s.search(filter, fuzzy, facetCondition), func(b Book) string { return string(b.Condition) })
+	result.Facets.Language = countFacet(s.search(filter, fuzzy, facetLanguage), func(b Book) string { return b.Language })
+	result.Facets.Format = countFacet(s.search(filter, fuzzy, facetFormat), func(b Book) string { return string(b.Format) })
+	return result, nil
+}
+
+// find mirrors findBooks: a search that finds nothing is retried fuzzily.
+// It returns every match, unpaged, so unlike findBooks it needn't trust the
+// cursor to know whether the exact search is empty.
+func (s *InMemoryBookStore) find(filter BookFilter) ([]Book, bool) {
+	books := s.search(filter, false, "")
+	if len(books) > 0 || ParseSearchQuery(filter.Query).Empty() {
+		return books, false
+	}
+	return s.search(filter, true, ""), true
+}
+
+// search is the in-memory books query, in list order but unpaged; fuzzy
+// and except work as in buildBookWhere.
+func (s *InMemoryBookStore) search(filter BookFilter, fuzzy bool, except string) []Book {
+	availability := filter.Availability
+	if availability == "" {
+		availability = AvailabilityAvailable
+	}
+
 	var filtered []Book
 	for _, b := range s.books {
-		if filter.Query != "" {
-			q := strings.ToLower(filter.Query)
-			if !strings.Contains(strings.ToLower(b.Title), q) && !strings.Contains(strings.ToLower(b.Author), q) {
+		if except != facetAvailability && availability != AvailabilityAny && b.Availability != availability {
+			continue
+		}
+		if except != facetGenre && filter.Genre != "" && b.Genre != filter.Genre {
+			continue
+		}
+		if filter.ISBN != "" && b.ISBN13 != filter.ISBN {
+			continue
+		}
+		if filter.WorkID != 0 && b.WorkID != filter.WorkID {
+			continue
+		}
+		if except != facetCondition && filter.Condition != "" && b.Condition != filter.Condition {
+			continue
+		}
+		if except != facetLanguage && filter.Language != "" && b.Language != filter.Language {
+			continue
+		}
+		if except != facetFormat && filter.Format != "" && b.Format != filter.Format {
+			continue
+		}
+		if except != facetLocation && filter.Location != "" && b.UserLocation != filter.Location {
+			continue
+		}
+		filtered = append(filtered, b)
+	}
+
+	ascending := filter.Sort == "oldest"
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return after(bookCursor(filtered[j]), bookCursor(filtered[i]), ascending)
+	})
+
+	// Searching re-ranks by relevance unless a date order was asked for;
+	// the stable sort keeps newest first among equal ranks.
+	if search := ParseSearchQuery(filter.Query); !search.Empty() {
+		if fuzzy {
+			filtered = fuzzySearchBooks(filtered, search.Text(), filter.byRelevance())
+		} else {
+			filtered = searchBooks(filtered, search, filter.byRelevance())
+		}
+	}
+	return filtered
+}
+
+// countFacet counts books by the non-empty values of field, most common
+// first.
+func countFacet(books []Book, field func(Book) string) []FacetCount {
+	counts := make(map[string]int)
+	for _, b := range books {
+		if v := field(b); v != "" {
+			counts[v]++
+		}
+	}
+
+	facet := []FacetCount{}
+	for v, n := range counts {
+		facet = append(facet, FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(facet, func(i, j int) bool {
+		if facet[i].Count != facet[j].Count {
+			return facet[i].Count > facet[j].Count
+		}
+		return facet[i].Value < facet[j].Value
+	})
+	return facet
+}
+
+// fuzzySearchBooks keeps the books whose title or author is similar to text,
+// most similar first if byRank.
+func fuzzySearchBooks(books []Book, text string, byRank bool) []Book {
+	var matched []Book
+	scores := make(map[int]float64)
+	for _, b := range books {
+		score := max(wordSimilarity(text, b.Title), wordSimilarity(text, b.Author))
+		if score >= fuzzyThreshold {
+			scores[b.ID] = score
+			matched = append(matched, b)
+		}
+	}
+	if byRank {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return scores[matched[i].ID] > scores[matched[j].ID]
+		})
+	}
+	return matched
+}
+
+func (s *InMemoryBookStore) Suggest(q string, limit int) ([]Suggestion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := ParseSearchQuery(q).Text()
+	if text == "" {
+		return []Suggestion{}, nil
+	}
+
+	type candidate struct {
+		Suggestion
+		rank  int // 0 starts with text, 1 has a word starting with it, 2 fuzzy
+		score float64
+	}
+	seen := make(map[Suggestion]bool)
+	var candidates []candidate
+	for _, b := range s.books {
+		if b.Availability == AvailabilityWithdrawn {
+			continue
+		}
+		for _, sg := range []Suggestion{{b.Title, "title"}, {b.Author, "author"}} {
+			if seen[sg] {
+				continue
+			}
+			c := candidate{Suggestion: sg, rank: 2, score: wordSimilarity(text, sg.Text)}
+			normalized := strings.Join(tokenize(sg.Text), " ")
+			switch {
+			case strings.HasPrefix(normalized, text):
+				c.rank = 0
+			case strings.Contains(" "+normalized, " "+text):
+				c.rank = 1
+			case c.score < fuzzyThreshold:
 				continue
 			}
+			seen[sg] = true
+			candidates = append(candidates, c)
 		}
-		filtered = append(filtered, b)
 	}
 
-	sort.Slice(filtered, func(i, j int) bool {
-		if filter.Sort == "oldest" {
-			return filtered[i].CreatedAt.Before(filtered[j].CreatedAt)
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.score != b.score {
+			return a.score > b.score
 		}
-		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
+		return a.Text < b.Text
 	})
 
-	return filtered, nil
+	suggestions := []Suggestion{}
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		suggestions = append(suggestions, candidates[i].Suggestion)
+	}
+	return suggestions, nil
 }
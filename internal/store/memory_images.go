@@ -0,0 +1,196 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// gallery returns a book's images in order. The caller must hold s.mu.
+func (s *InMemoryBookStore) gallery(bookID int) []BookImage {
+	images := []BookImage{}
+	for _, img := range s.images {
+		if img.BookID == bookID {
+			images = append(images, img)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Position < images[j].Position
+	})
+	return images
+}
+
+// updateImages applies fn to every stored image of a book. The caller must
+// hold s.mu.
+func (s *InMemoryBookStore) updateImages(bookID int, fn func(img *BookImage)) {
+	for i := range s.images {
+		if s.images[i].BookID == bookID {
+			fn(&s.images[i])
+		}
+	}
+}
+
+// touchGallery sets a book's ImagePath to its cover and bumps its version,
+// like galleryTx. The caller must hold s.mu.
+func (s *InMemoryBookStore) touchGallery(i int) {
+	s.books[i].ImagePath = ""
+	for _, img := range s.gallery(s.books[i].ID) {
+		if img.IsCover {
+			s.books[i].ImagePath = img.Path
+		}
+	}
+	s.books[i].UpdatedAt = time.Now()
+	s.books[i].Version++
+}
+
+// bookIndex returns the index of a book in s.books, or -1. The caller must
+// hold s.mu.
+func (s *InMemoryBookStore) bookIndex(id int) int {
+	for i, b := range s.books {
+		if b.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *InMemoryBookStore) GetImages(bookID int) ([]BookImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.gallery(bookID), nil
+}
+
+func (s *InMemoryBookStore) AddImage(bookID int, path string, cover bool) (BookImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.bookIndex(bookID)
+	if i < 0 {
+		return BookImage{}, ErrBookNotFound
+	}
+	images := s.gallery(bookID)
+	if len(images) >= MaxBookImages {
+		return BookImage{}, ErrTooManyImages
+	}
+	cover = cover || len(images) == 0
+	if cover {
+		s.updateImages(bookID, func(img *BookImage) { img.IsCover = false })
+	}
+	img := s.addImage(bookID, path, nextPosition(images), cover)
+	s.touchGallery(i)
+	return img, nil
+}
+
+// addImage stores a new image. The caller must hold s.mu.
+func (s *InMemoryBookStore) addImage(bookID int, path string, position int, cover bool) BookImage {
+	s.nextImageID++
+	img := BookImage{ID: s.nextImageID, BookID: bookID, Path: path, Position: position, IsCover: cover, CreatedAt: time.Now()}
+	s.images = append(s.images, img)
+	return img
+}
+
+func (s *InMemoryBookStore) ReorderImages(bookID int, imageIDs []int) ([]BookImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.bookIndex(bookID)
+	if i < 0 {
+		return nil, ErrBookNotFound
+	}
+	if !sameImages(s.gallery(bookID), imageIDs) {
+		return nil, ErrImageOrder
+	}
+	for pos, id := range imageIDs {
+		s.updateImages(bookID, func(img *BookImage) {
+			if img.ID == id {
+				img.Position = pos
+			}
+		})
+	}
+	s.touchGallery(i)
+	return s.gallery(bookID), nil
+}
+
+func (s *InMemoryBookStore) SetCoverImage(bookID, imageID int) ([]BookImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.bookIndex(bookID)
+	if i < 0 {
+		return nil, ErrBookNotFound
+	}
+	if findImage(s.gallery(bookID), imageID) < 0 {
+		return nil, ErrImageNotFound
+	}
+	s.updateImages(bookID, func(img *BookImage) { img.IsCover = img.ID == imageID })
+	s.touchGallery(i)
+	return s.gallery(bookID), nil
+}
+
+func (s *InMemoryBookStore) RemoveImage(bookID, imageID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.bookIndex(bookID)
+	if i < 0 {
+		return ErrBookNotFound
+	}
+	images := s.gallery(bookID)
+	at := findImage(images, imageID)
+	if at < 0 {
+		return ErrImageNotFound
+	}
+	for j, img := range s.images {
+		if img.ID == imageID {
+			s.images = append(s.images[:j], s.images[j+1:]...)
+			break
+		}
+	}
+	if images[at].IsCover && len(images) > 1 {
+		next := images[0]
+		if at == 0 {
+			next = images[1]
+		}
+		s.updateImages(bookID, func(img *BookImage) { img.IsCover = img.ID == next.ID })
+	}
+	s.touchGallery(i)
+	return nil
+}
+
+// syncCover is the in-memory syncCover. The caller must hold s.mu.
+func (s *InMemoryBookStore) syncCover(bookID int, path string) error {
+	images := s.gallery(bookID)
+	switch {
+	case path == "" || findPath(images, path) >= 0:
+		s.updateImages(bookID, func(img *BookImage) { img.IsCover = path != "" && img.Path == path })
+	case findCover(images) >= 0:
+		s.updateImages(bookID, func(img *BookImage) {
+			if img.IsCover {
+				img.Path = path
+			}
+		})
+	case len(images) >= MaxBookImages:
+		return ErrTooManyImages
+	default:
+		s.addImage(bookID, path, nextPosition(images), true)
+	}
+	return nil
+}
+
+func findPath(images []BookImage, path string) int {
+	for i, img := range images {
+		if img.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func findCover(images []BookImage) int {
+	for i, img := range images {
+		if img.IsCover {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryMediaStore counts references in the in-memory book and user
+// stores, as PostgresMediaStore does in their tables.
+type InMemoryMediaStore struct {
+	mu     sync.Mutex
+	media  []Media
+	nextID int
+	books  *InMemoryBookStore
+	users  *InMemoryUserStore
+}
+
+func NewInMemoryMediaStore(books *InMemoryBookStore, users *InMemoryUserStore) *InMemoryMediaStore {
+	return &InMemoryMediaStore{media: []Media{}, nextID: 1, books: books, users: users}
+}
+
+func (s *InMemoryMediaStore) Add(media Media) (Media, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	media.ID = s.nextID
+	s.nextID++
+	media.RefCount = 0
+	media.CreatedAt = time.Now()
+	unreferencedAt := media.CreatedAt
+	media.UnreferencedAt = &unreferencedAt
+	s.media = append(s.media, media)
+	return media, nil
+}
+
+func (s *InMemoryMediaStore) Unreferenced(now, cutoff time.Time, limit int) ([]Media, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs := s.references()
+	for i := range s.media {
+		m := &s.media[i]
+		m.RefCount = refs[m.Path]
+		if m.RefCount > 0 {
+			m.UnreferencedAt = nil
+		} else if m.UnreferencedAt == nil {
+			at := now
+			m.UnreferencedAt = &at
+		}
+	}
+
+	media := []Media{}
+	for _, m := range s.media {
+		if m.UnreferencedAt != nil && m.UnreferencedAt.Before(cutoff) {
+			media = append(media, m)
+		}
+	}
+	sort.SliceStable(media, func(i, j int) bool {
+		return media[i].UnreferencedAt.Before(*media[j].UnreferencedAt)
+	})
+	if len(media) > limit {
+		media = media[:limit]
+	}
+	return media, nil
+}
+
+func (s *InMemoryMediaStore) Delete(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs := s.references()
+	for i, m := range s.media {
+		if m.ID == id {
+			if refs[m.Path] > 0 {
+				return false, nil
+			}
+			s.media = append(s.media[:i], s.media[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// references counts the book covers, gallery images and avatars pointing at
+// each path. The caller must hold s.mu.
+func (s *InMemoryMediaStore) references() map[string]int {
+	refs := make(map[string]int)
+
+	s.books.mu.Lock()
+	for _, b := range s.books.books {
+		refs[b.ImagePath]++
+	}
+	for _, img := range s.books.images {
+		refs[img.Path]++
+	}
+	s.books.mu.Unlock()
+
+	s.users.mu.Lock()
+	for _, u := range s.users.users {
+		refs[u.AvatarPath]++
+	}
+	s.users.mu.Unlock()
+
+	return refs
+}
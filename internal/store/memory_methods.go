@@ -1,8 +1,8 @@
 package store
 
 import (
-	"errors"
 	"sort"
+	"time"
 )
 
 func (s *InMemoryBookStore) GetByID(id int) (Book, error) {
@@ -11,13 +11,14 @@ func (s *InMemoryBookStore) GetByID(id int) (Book, error) {
 
 	for _, book := range s.books {
 		if book.ID == id {
+			book.Images = s.gallery(id)
 			return book, nil
 		}
 	}
-	return Book{}, errors.New("book not found")
+	return Book{}, ErrBookNotFound
 }
 
-func (s *InMemoryBookStore) GetByUserID(userID int) ([]Book, error) {
+func (s *InMemoryBookStore) GetByUserID(userID int, page Page) (Paged[Book], error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -27,7 +28,10 @@ func (s *InMemoryBookStore) GetByUserID(userID int) ([]Book, error) {
 			userBooks = append(userBooks, book)
 		}
 	}
-	return userBooks, nil
+	sort.SliceStable(userBooks, func(i, j int) bool {
+		return after(bookCursor(userBooks[j]), bookCursor(userBooks[i]), false)
+	})
+	return pageSlice(userBooks, page, false, false, bookCursor), nil
 }
 
 func (s *InMemoryBookStore) Update(book Book) error {
@@ -36,11 +40,42 @@ func (s *InMemoryBookStore) Update(book Book) error {
 
 	for i, b := range s.books {
 		if b.ID == book.ID {
+			book.UpdatedAt = time.Now()
+			book.Version = b.Version + 1
+			if err := s.syncCover(book.ID, book.ImagePath); err != nil {
+				return err
+			}
+			book.WorkID = s.resolveWork(book)
 			s.books[i] = book
 			return nil
 		}
 	}
-	return errors.New("book not found")
+	return ErrBookNotFound
+}
+
+func (s *InMemoryBookStore) Patch(id int, patch BookPatch, version int) (Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, book := range s.books {
+		if book.ID == id {
+			if version > 0 && book.Version != version {
+				return Book{}, ErrVersionMismatch
+			}
+			book = patch.Apply(book)
+			book.UpdatedAt = time.Now()
+			book.Version++
+			if patch.ImagePath != nil {
+				if err := s.syncCover(book.ID, book.ImagePath); err != nil {
+					return Book{}, err
+				}
+			}
+			book.WorkID = s.resolveWork(book)
+			s.books[i] = book
+			return book, nil
+		}
+	}
+	return Book{}, ErrBookNotFound
 }
 
 func (s *InMemoryBookStore) Delete(id int) error {
@@ -50,10 +85,17 @@ func (s *InMemoryBookStore) Delete(id int) error {
 	for i, book := range s.books {
 		if book.ID == id {
 			s.books = append(s.books[:i], s.books[i+1:]...)
+			images := s.images[:0]
+			for _, img := range s.images {
+				if img.BookID != id {
+					images = append(images, img)
+				}
+			}
+			s.images = images
 			return nil
 		}
 	}
-	return errors.New("book not found")
+	return ErrBookNotFound
 }
 
 func (s *InMemoryBookStore) GetGenres() ([]string, error) {
@@ -96,3 +138,22 @@ func (s *InMemoryBookStore) GetPopularGenres() ([]GenreStats, error) {
 
 	return stats, nil
 }
+
+func (s *InMemoryBookStore) GetStats() (BookStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make(map[int]bool)
+	genres := make(map[string]bool)
+	works := make(map[int]bool)
+	for _, book := range s.books {
+		works[book.WorkID] = true
+		if book.UserID != 0 {
+			users[book.UserID] = true
+		}
+		if book.Genre != "" {
+			genres[book.Genre] = true
+		}
+	}
+	return BookStats{TotalBooks: len(s.books), ActiveUsers: len(users), TotalGenres: len(genres), TotalWorks: len(works)}, nil
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryRequestStore keeps requests in memory, reading their books and
+// requesters from the in-memory book and user stores as PostgresRequestStore
+// joins their tables. Requests for deleted books drop out of every list.
+type InMemoryRequestStore struct {
+	mu       sync.Mutex
+	requests []BookRequest
+	nextID   int
+	books    *InMemoryBookStore
+	users    *InMemoryUserStore
+}
+
+func NewInMemoryRequestStore(books *InMemoryBookStore, users *InMemoryUserStore) *InMemoryRequestStore {
+	return &InMemoryRequestStore{requests: []BookRequest{}, nextID: 1, books: books, users: users}
+}
+
+func (s *InMemoryRequestStore) CheckRequest(requesterID, bookID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkRequest(requesterID, bookID)
+}
+
+// checkRequest is CheckRequest. The caller must hold s.mu.
+func (s *InMemoryRequestStore) checkRequest(requesterID, bookID int) error {
+	cutoff := time.Now().Add(-RequestCooldown)
+	for _, r := range s.requests {
+		if r.RequesterID != requesterID || r.BookID != bookID {
+			continue
+		}
+		if r.Status.IsActive() {
+			return ErrRequestExists
+		}
+		if r.Status == RequestDeclined && r.DeclinedAt != nil && r.DeclinedAt.After(cutoff) {
+			return ErrRequestTooSoon
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryRequestStore) AddRequest(req BookRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkRequest(req.RequesterID, req.BookID); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.requests = append(s.requests, BookRequest{
+		ID:          s.nextID,
+		BookID:      req.BookID,
+		RequesterID: req.RequesterID,
+		Status:      RequestPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	s.nextID++
+	return nil
+}
+
+// joined returns r with its book's details, and false if the book is gone.
+// The caller must hold s.mu.
+func (s *InMemoryRequestStore) joined(r BookRequest) (BookRequest, bool) {
+	s.books.mu.Lock()
+	defer s.books.mu.Unlock()
+
+	for _, b := range s.books.books {
+		if b.ID == r.BookID {
+			r.OwnerID, r.BookTitle, r.BookAuthor, r.BookImage = b.UserID, b.Title, b.Author, b.ImagePath
+			return r, true
+		}
+	}
+	return BookRequest{}, false
+}
+
+// list returns the requests matching fn with their books, newest first. The
+// caller must hold s.mu.
+func (s *InMemoryRequestStore) list(fn func(BookRequest) bool) []BookRequest {
+	requests := []BookRequest{}
+	for _, r := range s.requests {
+		if r, ok := s.joined(r); ok && fn(r) {
+			requests = append(requests, r)
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return after(requestCursor(requests[j]), requestCursor(requests[i]), false)
+	})
+	return requests
+}
+
+func (s *InMemoryRequestStore) GetRequestByID(id int) (BookRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.requests {
+		if r.ID == id {
+			if r, ok := s.joined(r); ok {
+				return r, nil
+			}
+		}
+	}
+	return BookRequest{}, ErrRequestNotFound
+}
+
+func (s *InMemoryRequestStore) GetRequestsByUserID(userID int, page Page) (Paged[BookRequest], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.list(func(r BookRequest) bool { return r.RequesterID == userID })
+	return pageSlice(requests, page, false, false, requestCursor), nil
+}
+
+// UpdateRequestStatus mirrors PostgresRequestStore.UpdateRequestStatus,
+// book availability included.
+func (s *InMemoryRequestStore) UpdateRequestStatus(id int, status RequestStatus) (BookRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := -1
+	for j, r := range s.requests {
+		if r.ID == id {
+			i = j
+		}
+	}
+	if i < 0 {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	req, ok := s.joined(s.requests[i])
+	if !ok {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	if !CanTransition(req.Status, status) {
+		return BookRequest{}, ErrInvalidTransition
+	}
+
+	s.books.mu.Lock()
+	defer s.books.mu.Unlock()
+	b := -1
+	for j, book := range s.books.books {
+		if book.ID == req.BookID {
+			b = j
+		}
+	}
+	if b < 0 {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	book := &s.books.books[b]
+	if status == RequestAccepted && book.Availability != AvailabilityAvailable {
+		return BookRequest{}, ErrBookUnavailable
+	}
+
+	now := time.Now()
+	from := req.Status
+	setStatus(&s.requests[i], status, now)
+	if status == RequestAccepted {
+		for j, r := range s.requests {
+			if r.BookID == req.BookID && r.ID != id && r.Status == RequestPending {
+				setStatus(&s.requests[j], RequestDeclined, now)
+			}
+		}
+	}
+	if next := status.bookAvailability(from); next != "" && book.Availability != AvailabilityWithdrawn {
+		book.Availability = next
+		book.UpdatedAt = now
+		book.Version++
+	}
+
+	updated := s.requests[i]
+	updated.OwnerID, updated.BookTitle, updated.BookAuthor, updated.BookImage = req.OwnerID, req.BookTitle, req.BookAuthor, req.BookImage
+	return updated, nil
+}
+
+// setStatus moves r to status at now, stamping the matching timestamp.
+func setStatus(r *BookRequest, status RequestStatus, now time.Time) {
+	r.Status = status
+	r.UpdatedAt = now
+	at := now
+	switch status {
+	case RequestAccepted:
+		r.AcceptedAt = &at
+	case RequestDeclined:
+		r.DeclinedAt = &at
+	case RequestCompleted:
+		r.CompletedAt = &at
+	case RequestCancelled:
+		r.CancelledAt = &at
+	}
+}
+
+func (s *InMemoryRequestStore) GetIncomingRequests(ownerID int, filter IncomingRequestFilter) (Paged[IncomingRequest], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.list(func(r BookRequest) bool {
+		return r.OwnerID == ownerID &&
+			(filter.BookID == 0 || r.BookID == filter.BookID) &&
+			(filter.Status == "" || r.Status == filter.Status)
+	})
+
+	incoming := []IncomingRequest{}
+	for _, r := range requests {
+		requester, err := s.users.GetByID(r.RequesterID)
+		if err != nil {
+			continue
+		}
+		incoming = append(incoming, IncomingRequest{
+			BookRequest:         r,
+			RequesterUsername:   requester.Username,
+			RequesterAvatarPath: requester.AvatarPath,
+			RequesterLocation:   requester.Location,
+			RequesterBio:        requester.Bio,
+		})
+	}
+	return pageSlice(incoming, filter.Page, false, false, func(r IncomingRequest) Cursor {
+		return requestCursor(r.BookRequest)
+	}), nil
+}
+
+func (s *InMemoryRequestStore) GetTopRequestedBooks(limit int, since time.Time) ([]BookRequestStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[int]int)
+	for _, r := range s.requests {
+		if since.IsZero() || !r.CreatedAt.Before(since) {
+			counts[r.BookID]++
+		}
+	}
+
+	s.books.mu.Lock()
+	defer s.books.mu.Unlock()
+
+	// Count by work, linking to the copy GetTopRequestedBooks' SQL picks
+	byWork := make(map[int]*BookRequestStats)
+	copies := make(map[int]Book)
+	covers := make(map[int]Book)
+	for _, b := range s.books.books {
+		n := counts[b.ID]
+		if n == 0 {
+			continue
+		}
+		stats, ok := byWork[b.WorkID]
+		if !ok {
+			w := s.books.works[b.WorkID-1]
+			stats = &BookRequestStats{WorkID: w.ID, Title: w.Title, Author: w.Author}
+			byWork[b.WorkID] = stats
+		}
+		stats.RequestCount += n
+		if c, ok := copies[b.WorkID]; !ok || betterCover(b, c) {
+			copies[b.WorkID] = b
+			stats.BookID = b.ID
+		}
+		if c, ok := covers[b.WorkID]; b.ImagePath != "" && (!ok || betterCover(b, c)) {
+			covers[b.WorkID] = b
+			stats.ImagePath = b.ImagePath
+		}
+	}
+
+	top := []BookRequestStats{}
+	for _, stats := range byWork {
+		top = append(top, *stats)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].RequestCount != top[j].RequestCount {
+			return top[i].RequestCount > top[j].RequestCount
+		}
+		return top[i].WorkID < top[j].WorkID
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top, nil
+}
+
+func (s *InMemoryRequestStore) GetActiveRequest(userID, bookID int) (BookRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.list(func(r BookRequest) bool {
+		return r.RequesterID == userID && r.BookID == bookID && r.Status.IsActive()
+	})
+	if len(requests) == 0 {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	return requests[0], nil
+}
+
+func (s *InMemoryRequestStore) HasRequested(userID, bookID int) (bool, error) {
+	_, err := s.GetActiveRequest(userID, bookID)
+	if err == ErrRequestNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
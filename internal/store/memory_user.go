@@ -0,0 +1,217 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type InMemoryUserStore struct {
+	mu          sync.Mutex
+	users       []User
+	resetTokens map[string]resetToken
+	nextID      int
+}
+
+type resetToken struct {
+	userID int
+	expiry time.Time
+}
+
+func NewInMemoryUserStore() *InMemoryUserStore {
+	return &InMemoryUserStore{
+		users:       []User{},
+		resetTokens: make(map[string]resetToken),
+		nextID:      1,
+	}
+}
+
+// find returns the index of the first user matching fn, or -1.
+func (s *InMemoryUserStore) find(fn func(User) bool) int {
+	for i, u := range s.users {
+		if fn(u) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *InMemoryUserStore) Create(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(func(u User) bool { return u.Email == user.Email }) >= 0 {
+		return ErrEmailTaken
+	}
+	user.ID = s.nextID
+	s.nextID++
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	s.users = append(s.users, user)
+	return nil
+}
+
+func (s *InMemoryUserStore) GetByEmail(email string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(func(u User) bool { return u.Email == email }); i >= 0 {
+		return s.users[i], nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *InMemoryUserStore) GetByID(id int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(func(u User) bool { return u.ID == id }); i >= 0 {
+		return s.users[i], nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *InMemoryUserStore) GetByClerkID(clerkID string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.find(func(u User) bool { return u.ClerkID == clerkID }); i >= 0 {
+		return s.users[i], nil
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *InMemoryUserStore) UpsertByClerkID(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(func(u User) bool { return u.ClerkID == user.ClerkID })
+	if i < 0 {
+		i = s.find(func(u User) bool { return u.Email == user.Email })
+	}
+	if i < 0 {
+		user.ID = s.nextID
+		s.nextID++
+		user.Password = "clerk_managed_account"
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = user.CreatedAt
+		user.Version = 1
+		s.users = append(s.users, user)
+		return user, nil
+	}
+
+	s.users[i].Email = user.Email
+	s.users[i].Username = user.Username
+	s.users[i].AvatarPath = user.AvatarPath
+	s.users[i].ClerkID = user.ClerkID
+	s.users[i].UpdatedAt = time.Now()
+	s.users[i].Version++
+	return s.users[i], nil
+}
+
+func (s *InMemoryUserStore) DeleteByClerkID(clerkID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(func(u User) bool { return u.ClerkID == clerkID })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+	s.users = append(s.users[:i], s.users[i+1:]...)
+	return nil
+}
+
+func (s *InMemoryUserStore) Update(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(func(u User) bool { return u.ID == user.ID })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+	user.Password = s.users[i].Password
+	user.Email = s.users[i].Email
+	user.CreatedAt = s.users[i].CreatedAt
+	user.UpdatedAt = time.Now()
+	user.Version = s.users[i].Version + 1
+	s.users[i] = user
+	return nil
+}
+
+func (s *InMemoryUserStore) Patch(id int, patch UserPatch, version int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(func(u User) bool { return u.ID == id })
+	if i < 0 {
+		return User{}, ErrUserNotFound
+	}
+	if version > 0 && s.users[i].Version != version {
+		return User{}, ErrVersionMismatch
+	}
+	user := patch.Apply(s.users[i])
+	user.UpdatedAt = time.Now()
+	user.Version++
+	s.users[i] = user
+	return user, nil
+}
+
+func (s *InMemoryUserStore) SaveResetToken(token string, userID int, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetTokens[token] = resetToken{userID: userID, expiry: expiry}
+	return nil
+}
+
+func (s *InMemoryUserStore) GetResetToken(token string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.resetTokens[token]
+	if !ok {
+		return 0, time.Time{}, ErrResetTokenNotFound
+	}
+	return t.userID, t.expiry, nil
+}
+
+func (s *InMemoryUserStore) DeleteResetToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.resetTokens, token)
+	return nil
+}
+
+func (s *InMemoryUserStore) UpdatePassword(userID int, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(func(u User) bool { return u.ID == userID })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+	s.users[i].Password = password
+	return nil
+}
+
+func (s *InMemoryUserStore) GetMembers(searchQuery string, page Page) (Paged[User], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := strings.ToLower(searchQuery)
+	var members []User
+	for _, u := range s.users {
+		if q != "" && !strings.Contains(strings.ToLower(u.Username), q) {
+			continue
+		}
+		members = append(members, u)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return after(userCursor(members[j]), userCursor(members[i]), false)
+	})
+	return pageSlice(members, page, false, false, userCursor), nil
+}
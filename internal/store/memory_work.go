@@ -0,0 +1,67 @@
+package store
+
+// resolveWork is the in-memory resolveWork. The caller must hold s.mu.
+func (s *InMemoryBookStore) resolveWork(book Book) int {
+	if book.ISBN13 != "" {
+		for _, w := range s.works {
+			if w.ISBN13 == book.ISBN13 {
+				return w.ID
+			}
+		}
+	}
+	key := workKey(book.Title, book.Author)
+	for i, w := range s.works {
+		if workKey(w.Title, w.Author) == key {
+			if w.ISBN13 == "" {
+				s.works[i].ISBN13 = book.ISBN13
+			}
+			return w.ID
+		}
+	}
+	w := Work{ID: len(s.works) + 1, Title: book.Title, Author: book.Author, ISBN13: book.ISBN13}
+	s.works = append(s.works, w)
+	return w.ID
+}
+
+func (s *InMemoryBookStore) GetWork(id int) (Work, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > len(s.works) {
+		return Work{}, ErrWorkNotFound
+	}
+	w := s.works[id-1]
+	w.Editions = []string{}
+
+	seen := make(map[string]bool)
+	var cover Book
+	for _, b := range s.books {
+		if b.WorkID != id {
+			continue
+		}
+		if b.ISBN13 != "" && !seen[b.ISBN13] {
+			seen[b.ISBN13] = true
+			w.Editions = append(w.Editions, b.ISBN13)
+		}
+		if b.Availability != AvailabilityWithdrawn {
+			w.CopyCount++
+		}
+		if b.Availability == AvailabilityAvailable {
+			w.AvailableCount++
+		}
+		if b.ImagePath != "" && (cover.ImagePath == "" || betterCover(b, cover)) {
+			cover = b
+		}
+	}
+	w.CoverPath = cover.ImagePath
+	return w, nil
+}
+
+// betterCover reports whether b's image should represent its work over
+// than's: available copies first, then the newest, as in GetWork's SQL.
+func betterCover(b, than Book) bool {
+	if (b.Availability == AvailabilityAvailable) != (than.Availability == AvailabilityAvailable) {
+		return b.Availability == AvailabilityAvailable
+	}
+	return after(bookCursor(b), bookCursor(than), true)
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+var ErrConversationNotFound = apperr.NotFound("Conversation not found")
+
+// Conversation is the message thread between the requester and the owner
+// of a book request. There is at most one conversation per request.
+type Conversation struct {
+	ID            int        `json:"id"`
+	RequestID     int        `json:"request_id"`
+	BookID        int        `json:"book_id"`
+	BookTitle     string     `json:"book_title"`
+	RequesterID   int        `json:"requester_id"`
+	OwnerID       int        `json:"owner_id"`
+	OtherUsername string     `json:"other_username"`
+	OtherAvatar   string     `json:"other_avatar_path,omitempty"`
+	LastMessage   string     `json:"last_message,omitempty"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	UnreadCount   int        `json:"unread_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type Message struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	SenderID       int        `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+type MessageStore interface {
+	GetOrCreateConversation(requestID, userID int) (Conversation, error)
+	GetConversation(id, userID int) (Conversation, error)
+	GetConversations(userID int) ([]Conversation, error)
+	GetMessages(conversationID int) ([]Message, error)
+	AddMessage(msg Message) (Message, error)
+	MarkRead(conversationID, userID int) error
+}
+
+type PostgresMessageStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMessageStore(db *sql.DB) *PostgresMessageStore {
+	return &PostgresMessageStore{db: db}
+}
+
+// GetOrCreateConversation returns the conversation for a request as seen by
+// userID, opening one if the participants have not messaged each other yet.
+// Callers must check that userID takes part in the request.
+func (s *PostgresMessageStore) GetOrCreateConversation(requestID, userID int) (Conversation, error) {
+	query := `
+		INSERT INTO conversations (request_id)
+		VALUES ($1)
+		ON CONFLICT (request_id) DO UPDATE SET request_id = EXCLUDED.request_id
+		RETURNING id`
+
+	var id int
+	if err := s.db.QueryRow(query, requestID).Scan(&id); err != nil {
+		return Conversation{}, err
+	}
+
+	return s.GetConversation(id, userID)
+}
+
+// conversationQuery selects conversations visible to the user in $1, with
+// the other participant's profile and the user's unread count.
+const conversationQuery = `
+		SELECT c.id, c.request_id, br.book_id, b.title, br.requester_id, COALESCE(b.user_id, 0),
+			COALESCE(other.username, ''), COALESCE(other.avatar_path, ''),
+			COALESCE(last.body, ''), last.created_at,
+			(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.sender_id != $1 AND m.read_at IS NULL),
+			c.created_at
+		FROM conversations c
+		JOIN book_requests br ON c.request_id = br.id
+		JOIN books b ON br.book_id = b.id
+		LEFT JOIN users other ON other.id = CASE WHEN br.requester_id = $1 THEN b.user_id ELSE br.requester_id END
+		LEFT JOIN LATERAL (
+			SELECT body, created_at FROM messages m
+			WHERE m.conversation_id = c.id
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		) last ON true
+		WHERE (br.requester_id = $1 OR b.user_id = $1)`
+
+func scanConversation(row rowScanner) (Conversation, error) {
+	var c Conversation
+	var lastAt sql.NullTime
+	err := row.Scan(&c.ID, &c.RequestID, &c.BookID, &c.BookTitle, &c.RequesterID, &c.OwnerID,
+		&c.OtherUsername, &c.OtherAvatar, &c.LastMessage, &lastAt, &c.UnreadCount, &c.CreatedAt)
+	if err != nil {
+		return Conversation{}, err
+	}
+	c.LastMessageAt = nullTimePtr(lastAt)
+	return c, nil
+}
+
+// GetConversation returns the conversation if userID is one of its
+// participants, and ErrConversationNotFound otherwise.
+func (s *PostgresMessageStore) GetConversation(id, userID int) (Conversation, error) {
+	c, err := scanConversation(s.db.QueryRow(conversationQuery+` AND c.id = $2`, userID, id))
+	if err == sql.ErrNoRows {
+		return Conversation{}, ErrConversationNotFound
+	}
+	return c, err
+}
+
+func (s *PostgresMessageStore) GetConversations(userID int) ([]Conversation, error) {
+	rows, err := s.db.Query(conversationQuery+` ORDER BY COALESCE(last.created_at, c.created_at) DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+func (s *PostgresMessageStore) GetMessages(conversationID int) ([]Message, error) {
+	query := `
+		SELECT id, conversation_id, sender_id, body, created_at, read_at
+		FROM messages
+		WHERE conversation_id = $1
+		ORDER BY created_at ASC, id ASC`
+
+	rows, err := s.db.Query(query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		var readAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.CreatedAt, &readAt); err != nil {
+			return nil, err
+		}
+		m.ReadAt = nullTimePtr(readAt)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *PostgresMessageStore) AddMessage(msg Message) (Message, error) {
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err := s.db.QueryRow(query, msg.ConversationID, msg.SenderID, msg.Body).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+// MarkRead marks every message in the conversation sent to userID as read.
+func (s *PostgresMessageStore) MarkRead(conversationID, userID int) error {
+	query := `UPDATE messages SET read_at = NOW() WHERE conversation_id = $1 AND sender_id != $2 AND read_at IS NULL`
+	_, err := s.db.Exec(query, conversationID, userID)
+	return err
+}
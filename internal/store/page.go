@@ -0,0 +1,170 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidCursor = apperr.BadRequest("Invalid cursor")
+
+// Cursor marks where a page ended. Lists ordered by date resume after the
+// (created_at, id) of their last row; lists ordered by search relevance,
+// which has no stable key, resume at an offset. Fuzzy marks the pages of a
+// search that fell back to fuzzy matching, so later pages match the same way.
+type Cursor struct {
+	CreatedAt time.Time `json:"t,omitzero"`
+	ID        int       `json:"id,omitempty"`
+	Offset    int       `json:"o,omitempty"`
+	Fuzzy     bool      `json:"f,omitempty"`
+}
+
+// Encode returns the cursor in the opaque form clients pass back.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor from Encode. The empty string is the first
+// page and decodes to nil.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Offset < 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Page selects one page of a list.
+type Page struct {
+	Limit int     // Page size; zero means DefaultPageSize, capped at MaxPageSize
+	After *Cursor // Resume after this cursor; nil for the first page
+}
+
+// Size returns the effective page size.
+func (p Page) Size() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultPageSize
+	case p.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return p.Limit
+}
+
+// Paged is one page of a list, with the total across all pages.
+type Paged[T any] struct {
+	Results    []T    `json:"results"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// keyset adds the WHERE condition, ORDER BY and LIMIT for a page of rows
+// ordered by (created_at, id) to query, whose WHERE clause is already open.
+// It fetches one row more than the page size so newPaged can tell whether
+// there is another page.
+func (p Page) keyset(query string, args []interface{}, alias string, ascending bool) (string, []interface{}) {
+	op, dir := "<", "DESC"
+	if ascending {
+		op, dir = ">", "ASC"
+	}
+	if p.After != nil {
+		query += ` AND (` + alias + `.created_at, ` + alias + `.id) ` + op + ` ($` + strconv.Itoa(len(args)+1) + `, $` + strconv.Itoa(len(args)+2) + `)`
+		args = append(args, p.After.CreatedAt, p.After.ID)
+	}
+	query += ` ORDER BY ` + alias + `.created_at ` + dir + `, ` + alias + `.id ` + dir
+	query += ` LIMIT $` + strconv.Itoa(len(args)+1)
+	args = append(args, p.Size()+1)
+	return query, args
+}
+
+// offset adds LIMIT and OFFSET for a page of a list with no stable key.
+func (p Page) offset(query string, args []interface{}) (string, []interface{}) {
+	query += ` LIMIT $` + strconv.Itoa(len(args)+1)
+	args = append(args, p.Size()+1)
+	if p.After != nil && p.After.Offset > 0 {
+		query += ` OFFSET $` + strconv.Itoa(len(args)+1)
+		args = append(args, p.After.Offset)
+	}
+	return query, args
+}
+
+// newPaged trims rows, fetched with one extra, to the page and sets the next
+// cursor from the last row kept. With byOffset the cursor is an offset.
+func newPaged[T any](rows []T, total int, p Page, byOffset bool, key func(T) Cursor) Paged[T] {
+	paged := Paged[T]{Results: rows, Total: total}
+	if paged.Results == nil {
+		paged.Results = []T{}
+	}
+	if len(rows) <= p.Size() {
+		return paged
+	}
+
+	paged.Results = rows[:p.Size()]
+	if byOffset {
+		start := 0
+		if p.After != nil {
+			start = p.After.Offset
+		}
+		paged.NextCursor = Cursor{Offset: start + p.Size()}.Encode()
+	} else {
+		paged.NextCursor = key(paged.Results[p.Size()-1]).Encode()
+	}
+	return paged
+}
+
+// markFuzzy marks the next cursor of a page of fuzzy search results.
+func markFuzzy[T any](paged Paged[T]) Paged[T] {
+	if c, err := DecodeCursor(paged.NextCursor); err == nil && c != nil {
+		c.Fuzzy = true
+		paged.NextCursor = c.Encode()
+	}
+	return paged
+}
+
+// pageSlice is the in-memory counterpart of keyset and offset: it pages
+// through rows that are already in list order.
+func pageSlice[T any](rows []T, p Page, byOffset, ascending bool, key func(T) Cursor) Paged[T] {
+	total := len(rows)
+	if p.After != nil {
+		if byOffset {
+			rows = rows[min(p.After.Offset, len(rows)):]
+		} else {
+			rest := rows[:0:0]
+			for _, row := range rows {
+				if after(key(row), *p.After, ascending) {
+					rest = append(rest, row)
+				}
+			}
+			rows = rest
+		}
+	}
+	if len(rows) > p.Size()+1 {
+		rows = rows[:p.Size()+1]
+	}
+	return newPaged(rows, total, p, byOffset, key)
+}
+
+// after reports whether c comes after cursor in a list ordered by
+// (created_at, id).
+func after(c, cursor Cursor, ascending bool) bool {
+	if !c.CreatedAt.Equal(cursor.CreatedAt) {
+		return c.CreatedAt.After(cursor.CreatedAt) == ascending
+	}
+	return c.ID != cursor.ID && (c.ID > cursor.ID) == ascending
+}
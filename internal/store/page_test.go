@@ -0,0 +1,80 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), ID: 42}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("DecodeCursor(Encode(%v)) = %v", c, got)
+	}
+
+	for _, bad := range []string{"!!!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(bad); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+	// Offset cursors leave the time out rather than encoding its zero value
+	if got := (Cursor{Offset: 20}).Encode(); got != "eyJvIjoyMH0" {
+		t.Errorf("Cursor{Offset: 20}.Encode() = %q, want only the offset", got)
+	}
+	if c, err := DecodeCursor(""); c != nil || err != nil {
+		t.Errorf("DecodeCursor(\"\") = %v, %v, want the first page", c, err)
+	}
+}
+
+func TestInMemoryPagination(t *testing.T) {
+	s := NewInMemoryBookStore()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		// Two books share each timestamp, so the ID has to break ties
+		if _, err := s.Add(Book{Title: "Book", UserID: 1, CreatedAt: start.Add(time.Duration(i/2) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []int
+	page := Page{Limit: 2}
+	for {
+		paged, err := s.GetByUserID(1, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paged.Total != 5 {
+			t.Errorf("Total = %d, want 5", paged.Total)
+		}
+		for _, b := range paged.Results {
+			seen = append(seen, b.ID)
+		}
+		if paged.NextCursor == "" {
+			break
+		}
+		if page.After, err = DecodeCursor(paged.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []int{5, 4, 3, 2, 1}
+	if len(seen) != len(want) {
+		t.Fatalf("paged through %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("paged through %v, want %v", seen, want)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for limit, want := range map[int]int{0: DefaultPageSize, -1: DefaultPageSize, 7: 7, 1000: MaxPageSize} {
+		if got := (Page{Limit: limit}).Size(); got != want {
+			t.Errorf("Page{Limit: %d}.Size() = %d, want %d", limit, got, want)
+		}
+	}
+}
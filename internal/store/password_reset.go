@@ -1,6 +1,7 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 )
 
@@ -15,6 +16,9 @@ func (s *PostgresUserStore) GetResetToken(token string) (int, time.Time, error)
 	var userID int
 	var expiry time.Time
 	err := s.db.QueryRow(query, token).Scan(&userID, &expiry)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, ErrResetTokenNotFound
+	}
 	if err != nil {
 		return 0, time.Time{}, err
 	}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	"testbook-backend/internal/apperr"
+)
+
+// ErrVersionMismatch is returned by conditional updates when the row has
+// been changed since the caller read it.
+var ErrVersionMismatch = apperr.PreconditionFailed("Resource has been modified, fetch it again and retry")
+
+// patchUpdate builds and runs an UPDATE that sets only the given columns and
+// bumps the row's version. A version above zero makes the update conditional
+// on the row still being at that version.
+type patchUpdate struct {
+	table string
+	sets  []string
+	args  []interface{}
+}
+
+func (p *patchUpdate) set(column string, value interface{}) {
+	p.args = append(p.args, value)
+	p.sets = append(p.sets, column+" = $"+strconv.Itoa(len(p.args)))
+}
+
+// exec applies the update to row id. It returns notFound if the row doesn't
+// exist and ErrVersionMismatch if it has moved past version.
+func (p *patchUpdate) exec(q queryer, id, version int, notFound error) error {
+	sets := append(p.sets, "version = version + 1", "updated_at = CURRENT_TIMESTAMP")
+	args := append(p.args, id)
+	query := `UPDATE ` + p.table + ` SET ` + strings.Join(sets, ", ") + ` WHERE id = $` + strconv.Itoa(len(args))
+	if version > 0 {
+		args = append(args, version)
+		query += ` AND version = $` + strconv.Itoa(len(args))
+	}
+
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// Nothing matched: tell a missing row from a stale version
+	var exists bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+p.table+` WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return notFound
+	}
+	return ErrVersionMismatch
+}
@@ -6,25 +6,38 @@ import (
 )
 
 type BookRequest struct {
-	ID          int       `json:"id"`
-	BookID      int       `json:"book_id"`
-	RequesterID int       `json:"requester_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	BookTitle   string    `json:"book_title,omitempty"`
-	BookAuthor  string    `json:"book_author,omitempty"`
-	BookImage   string    `json:"book_image,omitempty"`
+	ID          int           `json:"id"`
+	BookID      int           `json:"book_id"`
+	RequesterID int           `json:"requester_id"`
+	OwnerID     int           `json:"owner_id,omitempty"`
+	Status      RequestStatus `json:"status"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	AcceptedAt  *time.Time    `json:"accepted_at,omitempty"`
+	DeclinedAt  *time.Time    `json:"declined_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	CancelledAt *time.Time    `json:"cancelled_at,omitempty"`
+	BookTitle   string        `json:"book_title,omitempty"`
+	BookAuthor  string        `json:"book_author,omitempty"`
+	BookImage   string        `json:"book_image,omitempty"`
 }
 
 type RequestStore interface {
+	CheckRequest(requesterID, bookID int) error
 	AddRequest(req BookRequest) error
-	GetRequestsByUserID(userID int) ([]BookRequest, error)
-	GetTopRequestedBooks(limit int) ([]BookRequestStats, error)
-	DeleteRequest(userID, bookID int) error
+	GetRequestByID(id int) (BookRequest, error)
+	GetRequestsByUserID(userID int, page Page) (Paged[BookRequest], error)
+	UpdateRequestStatus(id int, status RequestStatus) (BookRequest, error)
+	GetIncomingRequests(ownerID int, filter IncomingRequestFilter) (Paged[IncomingRequest], error)
+	GetTopRequestedBooks(limit int, since time.Time) ([]BookRequestStats, error)
+	GetActiveRequest(userID, bookID int) (BookRequest, error)
 	HasRequested(userID, bookID int) (bool, error)
 }
 
+// BookRequestStats is how often copies of a work have been requested.
 type BookRequestStats struct {
-	BookID       int    `json:"book_id"`
+	WorkID       int    `json:"work_id"`
+	BookID       int    `json:"book_id"` // A copy to link to, available ones first
 	Title        string `json:"title"`
 	Author       string `json:"author"`
 	ImagePath    string `json:"image_path"`
@@ -39,50 +52,101 @@ func NewPostgresRequestStore(db *sql.DB) *PostgresRequestStore {
 	return &PostgresRequestStore{db: db}
 }
 
+// CheckRequest returns ErrRequestExists if requesterID already has an active
+// request for bookID, and ErrRequestTooSoon if the owner declined their last
+// one less than RequestCooldown ago.
+func (s *PostgresRequestStore) CheckRequest(requesterID, bookID int) error {
+	var active, declined bool
+	err := s.db.QueryRow(`
+		SELECT
+			EXISTS(SELECT 1 FROM book_requests WHERE book_id = $1 AND requester_id = $2 AND status IN ($3, $4)),
+			EXISTS(SELECT 1 FROM book_requests WHERE book_id = $1 AND requester_id = $2 AND status = $5 AND declined_at > $6)`,
+		bookID, requesterID, RequestPending, RequestAccepted, RequestDeclined, time.Now().Add(-RequestCooldown)).Scan(&active, &declined)
+	switch {
+	case err != nil:
+		return err
+	case active:
+		return ErrRequestExists
+	case declined:
+		return ErrRequestTooSoon
+	}
+	return nil
+}
+
+// AddRequest records a new pending request, failing as CheckRequest does.
+// The unique index on active requests catches a duplicate racing past the
+// check.
 func (s *PostgresRequestStore) AddRequest(req BookRequest) error {
-	query := `
-		INSERT INTO book_requests (book_id, requester_id)
-		VALUES ($1, $2)
-		ON CONFLICT (book_id, requester_id) DO NOTHING`
-	_, err := s.db.Exec(query, req.BookID, req.RequesterID)
+	if err := s.CheckRequest(req.RequesterID, req.BookID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO book_requests (book_id, requester_id) VALUES ($1, $2)`, req.BookID, req.RequesterID)
+	if isUniqueViolation(err) {
+		return ErrRequestExists.Wrap(err)
+	}
 	return err
 }
 
-func (s *PostgresRequestStore) GetRequestsByUserID(userID int) ([]BookRequest, error) {
-	query := `
-		SELECT br.id, br.book_id, br.requester_id, br.created_at, b.title, b.author, COALESCE(b.image_path, '')
+// requestCursor is the keyset position of a request in a list.
+func requestCursor(r BookRequest) Cursor {
+	return Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+}
+
+func (s *PostgresRequestStore) GetRequestsByUserID(userID int, page Page) (Paged[BookRequest], error) {
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM book_requests WHERE requester_id = $1`, userID).Scan(&total); err != nil {
+		return Paged[BookRequest]{}, err
+	}
+
+	query, args := page.keyset(`
+		SELECT `+requestColumns+`
 		FROM book_requests br
 		JOIN books b ON br.book_id = b.id
-		WHERE br.requester_id = $1
-		ORDER BY br.created_at DESC`
+		WHERE br.requester_id = $1`, []interface{}{userID}, "br", false)
 
-	rows, err := s.db.Query(query, userID)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return Paged[BookRequest]{}, err
 	}
 	defer rows.Close()
 
 	requests := []BookRequest{}
 	for rows.Next() {
-		var r BookRequest
-		if err := rows.Scan(&r.ID, &r.BookID, &r.RequesterID, &r.CreatedAt, &r.BookTitle, &r.BookAuthor, &r.BookImage); err != nil {
-			return nil, err
+		r, err := scanRequest(rows)
+		if err != nil {
+			return Paged[BookRequest]{}, err
 		}
 		requests = append(requests, r)
 	}
-	return requests, nil
+	if err := rows.Err(); err != nil {
+		return Paged[BookRequest]{}, err
+	}
+	return newPaged(requests, total, page, false, requestCursor), nil
 }
 
-func (s *PostgresRequestStore) GetTopRequestedBooks(limit int) ([]BookRequestStats, error) {
+// GetTopRequestedBooks ranks works by the requests made for all their
+// copies, counting only requests made since since unless it is zero.
+func (s *PostgresRequestStore) GetTopRequestedBooks(limit int, since time.Time) ([]BookRequestStats, error) {
+	args := []interface{}{limit}
 	query := `
-		SELECT b.id, b.title, b.author, COALESCE(b.image_path, ''), COUNT(br.id) as request_count
-		FROM books b
-		JOIN book_requests br ON b.id = br.book_id
-		GROUP BY b.id
-		ORDER BY request_count DESC
+		SELECT w.id,
+			(array_agg(b.id ORDER BY b.availability = 'available' DESC, b.created_at DESC))[1],
+			w.title, w.author,
+			COALESCE((array_agg(b.image_path ORDER BY b.availability = 'available' DESC, b.created_at DESC) FILTER (WHERE COALESCE(b.image_path, '') != ''))[1], ''),
+			COUNT(br.id) as request_count
+		FROM works w
+		JOIN books b ON b.work_id = w.id
+		JOIN book_requests br ON b.id = br.book_id`
+	if !since.IsZero() {
+		query += ` WHERE br.created_at >= $2`
+		args = append(args, since)
+	}
+	query += `
+		GROUP BY w.id
+		ORDER BY request_count DESC, w.id
 		LIMIT $1`
 
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -91,23 +155,154 @@ func (s *PostgresRequestStore) GetTopRequestedBooks(limit int) ([]BookRequestSta
 	stats := []BookRequestStats{}
 	for rows.Next() {
 		var s BookRequestStats
-		if err := rows.Scan(&s.BookID, &s.Title, &s.Author, &s.ImagePath, &s.RequestCount); err != nil {
+		if err := rows.Scan(&s.WorkID, &s.BookID, &s.Title, &s.Author, &s.ImagePath, &s.RequestCount); err != nil {
 			return nil, err
 		}
 		stats = append(stats, s)
 	}
-	return stats, nil
+	return stats, rows.Err()
 }
 
-func (s *PostgresRequestStore) DeleteRequest(userID, bookID int) error {
-	query := `DELETE FROM book_requests WHERE requester_id = $1 AND book_id = $2`
-	_, err := s.db.Exec(query, userID, bookID)
-	return err
+// GetActiveRequest returns userID's pending or accepted request for bookID,
+// or ErrRequestNotFound if there is none.
+func (s *PostgresRequestStore) GetActiveRequest(userID, bookID int) (BookRequest, error) {
+	query := `
+		SELECT ` + requestColumns + `
+		FROM book_requests br
+		JOIN books b ON br.book_id = b.id
+		WHERE br.requester_id = $1 AND br.book_id = $2 AND br.status IN ($3, $4)
+		ORDER BY br.created_at DESC
+		LIMIT 1`
+
+	r, err := scanRequest(s.db.QueryRow(query, userID, bookID, RequestPending, RequestAccepted))
+	if err == sql.ErrNoRows {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	return r, err
 }
 
 func (s *PostgresRequestStore) HasRequested(userID, bookID int) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM book_requests WHERE requester_id = $1 AND book_id = $2)`
+	query := `SELECT EXISTS(SELECT 1 FROM book_requests WHERE requester_id = $1 AND book_id = $2 AND status IN ('pending', 'accepted'))`
 	var exists bool
 	err := s.db.QueryRow(query, userID, bookID).Scan(&exists)
 	return exists, err
 }
+
+const requestColumns = `br.id, br.book_id, br.requester_id, COALESCE(b.user_id, 0), br.status, br.created_at, COALESCE(br.updated_at, br.created_at),
+		br.accepted_at, br.declined_at, br.completed_at, br.cancelled_at, b.title, b.author, COALESCE(b.image_path, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRequest scans the requestColumns of a row into a BookRequest. Any
+// extra destinations are filled from the columns that follow them.
+func scanRequest(row rowScanner, extra ...interface{}) (BookRequest, error) {
+	var r BookRequest
+	var acceptedAt, declinedAt, completedAt, cancelledAt sql.NullTime
+	dest := []interface{}{&r.ID, &r.BookID, &r.RequesterID, &r.OwnerID, &r.Status, &r.CreatedAt, &r.UpdatedAt,
+		&acceptedAt, &declinedAt, &completedAt, &cancelledAt, &r.BookTitle, &r.BookAuthor, &r.BookImage}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return BookRequest{}, err
+	}
+	r.AcceptedAt = nullTimePtr(acceptedAt)
+	r.DeclinedAt = nullTimePtr(declinedAt)
+	r.CompletedAt = nullTimePtr(completedAt)
+	r.CancelledAt = nullTimePtr(cancelledAt)
+	return r, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (s *PostgresRequestStore) GetRequestByID(id int) (BookRequest, error) {
+	query := `
+		SELECT ` + requestColumns + `
+		FROM book_requests br
+		JOIN books b ON br.book_id = b.id
+		WHERE br.id = $1`
+
+	r, err := scanRequest(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	return r, err
+}
+
+// UpdateRequestStatus moves a request to status, stamping the matching
+// transition timestamp, and keeps its book's availability in step: accepting
+// reserves the book and declines the book's other pending requests,
+// completing marks it swapped, and cancelling an accepted swap frees it
+// again. It returns ErrInvalidTransition if the request's current status does
+// not allow the move, and ErrBookUnavailable when accepting a request for a
+// book that isn't available.
+func (s *PostgresRequestStore) UpdateRequestStatus(id int, status RequestStatus) (BookRequest, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return BookRequest{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the book before the request, as accepting locks its other
+	// requests after it, so two requests for one book can't both be accepted
+	var bookID int
+	var availability Availability
+	err = tx.QueryRow(`
+		SELECT b.id, b.availability
+		FROM books b
+		WHERE b.id = (SELECT book_id FROM book_requests WHERE id = $1)
+		FOR UPDATE`, id).Scan(&bookID, &availability)
+	if err == sql.ErrNoRows {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	if err != nil {
+		return BookRequest{}, err
+	}
+
+	var current RequestStatus
+	err = tx.QueryRow(`SELECT status FROM book_requests WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return BookRequest{}, ErrRequestNotFound
+	}
+	if err != nil {
+		return BookRequest{}, err
+	}
+
+	if !CanTransition(current, status) {
+		return BookRequest{}, ErrInvalidTransition
+	}
+	if status == RequestAccepted && availability != AvailabilityAvailable {
+		return BookRequest{}, ErrBookUnavailable
+	}
+
+	query := `UPDATE book_requests SET status = $1, updated_at = NOW(), ` + status.timestampColumn() + ` = NOW() WHERE id = $2`
+	if _, err := tx.Exec(query, status, id); err != nil {
+		return BookRequest{}, err
+	}
+
+	if status == RequestAccepted {
+		query := `UPDATE book_requests SET status = $1, updated_at = NOW(), ` + RequestDeclined.timestampColumn() + ` = NOW()
+			WHERE book_id = $2 AND id != $3 AND status = $4`
+		if _, err := tx.Exec(query, RequestDeclined, bookID, id, RequestPending); err != nil {
+			return BookRequest{}, err
+		}
+	}
+
+	// A book its owner has withdrawn stays withdrawn whatever the swap does
+	if next := status.bookAvailability(current); next != "" && availability != AvailabilityWithdrawn {
+		query := `UPDATE books SET availability = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+		if _, err := tx.Exec(query, next, bookID); err != nil {
+			return BookRequest{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return BookRequest{}, err
+	}
+
+	return s.GetRequestByID(id)
+}
@@ -0,0 +1,70 @@
+package store
+
+import "strconv"
+
+// IncomingRequest is a request received on a book the user owns, along with
+// the public profile of the member who made it.
+type IncomingRequest struct {
+	BookRequest
+	RequesterUsername   string `json:"requester_username"`
+	RequesterAvatarPath string `json:"requester_avatar_path,omitempty"`
+	RequesterLocation   string `json:"requester_location,omitempty"`
+	RequesterBio        string `json:"requester_bio,omitempty"`
+}
+
+type IncomingRequestFilter struct {
+	BookID int           // Only requests for this book
+	Status RequestStatus // Only requests in this status
+	Page   Page
+}
+
+func (s *PostgresRequestStore) GetIncomingRequests(ownerID int, filter IncomingRequestFilter) (Paged[IncomingRequest], error) {
+	where := `
+		FROM book_requests br
+		JOIN books b ON br.book_id = b.id
+		JOIN users u ON br.requester_id = u.id
+		WHERE b.user_id = $1`
+	args := []interface{}{ownerID}
+
+	if filter.BookID != 0 {
+		where += ` AND br.book_id = $` + strconv.Itoa(len(args)+1)
+		args = append(args, filter.BookID)
+	}
+
+	if filter.Status != "" {
+		where += ` AND br.status = $` + strconv.Itoa(len(args)+1)
+		args = append(args, filter.Status)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*)`+where, args...).Scan(&total); err != nil {
+		return Paged[IncomingRequest]{}, err
+	}
+
+	query, args := filter.Page.keyset(`
+		SELECT `+requestColumns+`,
+			COALESCE(u.username, ''), COALESCE(u.avatar_path, ''), COALESCE(u.location, ''), COALESCE(u.bio, '')`+where, args, "br", false)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return Paged[IncomingRequest]{}, err
+	}
+	defer rows.Close()
+
+	requests := []IncomingRequest{}
+	for rows.Next() {
+		var r IncomingRequest
+		req, err := scanRequest(rows, &r.RequesterUsername, &r.RequesterAvatarPath, &r.RequesterLocation, &r.RequesterBio)
+		if err != nil {
+			return Paged[IncomingRequest]{}, err
+		}
+		r.BookRequest = req
+		requests = append(requests, r)
+	}
+	if err := rows.Err(); err != nil {
+		return Paged[IncomingRequest]{}, err
+	}
+	return newPaged(requests, total, filter.Page, false, func(r IncomingRequest) Cursor {
+		return requestCursor(r.BookRequest)
+	}), nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"time"
+
+	"testbook-backend/internal/apperr"
+)
+
+type RequestStatus string
+
+const (
+	RequestPending   RequestStatus = "pending"
+	RequestAccepted  RequestStatus = "accepted"
+	RequestDeclined  RequestStatus = "declined"
+	RequestCompleted RequestStatus = "completed"
+	RequestCancelled RequestStatus = "cancelled"
+)
+
+var (
+	ErrRequestNotFound   = apperr.NotFound("Request not found")
+	ErrInvalidTransition = apperr.Conflict("Invalid request status transition")
+	ErrBookUnavailable   = apperr.Conflict("Book is not available")
+	ErrRequestExists     = apperr.Conflict("You have already requested this book")
+	ErrRequestTooSoon    = apperr.Conflict("Your last request for this book was declined recently")
+)
+
+// RequestCooldown is how long a member whose request was declined must wait
+// before asking for the same book again.
+const RequestCooldown = 7 * 24 * time.Hour
+
+// requestTransitions lists, for each target status, the statuses a request
+// may move from. Declined, completed and cancelled are terminal.
+var requestTransitions = map[RequestStatus][]RequestStatus{
+	RequestAccepted:  {RequestPending},
+	RequestDeclined:  {RequestPending},
+	RequestCompleted: {RequestAccepted},
+	RequestCancelled: {RequestPending, RequestAccepted},
+}
+
+// CanTransition reports whether a request in status from may move to status to.
+func CanTransition(from, to RequestStatus) bool {
+	for _, s := range requestTransitions[to] {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the request still blocks a new request for the same book.
+func (s RequestStatus) IsActive() bool {
+	return s == RequestPending || s == RequestAccepted
+}
+
+// bookAvailability returns the availability a request's book takes when the
+// request moves from status from to s, or "" if it keeps its own.
+func (s RequestStatus) bookAvailability(from RequestStatus) Availability {
+	switch {
+	case s == RequestAccepted:
+		return AvailabilityReserved
+	case s == RequestCompleted:
+		return AvailabilitySwapped
+	case s == RequestCancelled && from == RequestAccepted:
+		return AvailabilityAvailable
+	}
+	return ""
+}
+
+// timestampColumn returns the book_requests column recording when a request entered status s.
+func (s RequestStatus) timestampColumn() string {
+	switch s {
+	case RequestAccepted:
+		return "accepted_at"
+	case RequestDeclined:
+		return "declined_at"
+	case RequestCompleted:
+		return "completed_at"
+	case RequestCancelled:
+		return "cancelled_at"
+	}
+	return ""
+}
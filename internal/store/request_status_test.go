@@ -0,0 +1,46 @@
+package store
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to RequestStatus
+		want     bool
+	}{
+		{RequestPending, RequestAccepted, true},
+		{RequestPending, RequestDeclined, true},
+		{RequestPending, RequestCancelled, true},
+		{RequestPending, RequestCompleted, false},
+		{RequestAccepted, RequestCompleted, true},
+		{RequestAccepted, RequestCancelled, true},
+		{RequestAccepted, RequestDeclined, false},
+		{RequestDeclined, RequestAccepted, false},
+		{RequestCompleted, RequestCancelled, false},
+		{RequestCancelled, RequestPending, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBookAvailability(t *testing.T) {
+	tests := []struct {
+		from, to RequestStatus
+		want     Availability
+	}{
+		{RequestPending, RequestAccepted, AvailabilityReserved},
+		{RequestPending, RequestDeclined, ""},
+		{RequestPending, RequestCancelled, ""},
+		{RequestAccepted, RequestCompleted, AvailabilitySwapped},
+		{RequestAccepted, RequestCancelled, AvailabilityAvailable},
+	}
+
+	for _, tt := range tests {
+		if got := tt.to.bookAvailability(tt.from); got != tt.want {
+			t.Errorf("%s to %s: book availability %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
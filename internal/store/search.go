@@ -0,0 +1,282 @@
+package store
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchConfig is the Postgres text search configuration the books
+// search_vector column is built with.
+const searchConfig = "english"
+
+// SearchTerm is one clause of a search: a single word, or a phrase whose
+// words must appear next to each other. A prefix term matches any word
+// starting with its last word.
+type SearchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+// SearchQuery is a parsed book search. Every term has to match.
+//
+// Plain words are matched on their own, "quoted words" as a phrase, and a
+// trailing * (as in tolk*) matches by prefix.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// ParseSearchQuery parses user input into a SearchQuery. Punctuation is
+// dropped, so the result is always safe to turn into a tsquery.
+func ParseSearchQuery(q string) SearchQuery {
+	var query SearchQuery
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+
+		var chunk string
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				chunk, q = q[1:], ""
+			} else {
+				chunk, q = q[1:end+1], q[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(q, unicode.IsSpace)
+			if end < 0 {
+				end = len(q)
+			}
+			chunk, q = q[:end], q[end:]
+		}
+
+		term := SearchTerm{
+			Words:  tokenize(chunk),
+			Prefix: strings.HasSuffix(strings.TrimSpace(chunk), "*"),
+		}
+		if len(term.Words) > 0 {
+			query.Terms = append(query.Terms, term)
+		}
+	}
+	return query
+}
+
+// Empty reports whether the query has nothing to search for.
+func (q SearchQuery) Empty() bool {
+	return len(q.Terms) == 0
+}
+
+// TSQuery renders q in to_tsquery syntax: terms are ANDed, phrase words are
+// joined with <-> and prefix terms end in :*.
+func (q SearchQuery) TSQuery() string {
+	terms := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		t := strings.Join(term.Words, " <-> ")
+		if term.Prefix {
+			t += ":*"
+		}
+		if len(term.Words) > 1 {
+			t = "(" + t + ")"
+		}
+		terms = append(terms, t)
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Text returns every word of q separated by spaces, as plain text for
+// similarity matching.
+func (q SearchQuery) Text() string {
+	var words []string
+	for _, term := range q.Terms {
+		words = append(words, term.Words...)
+	}
+	return strings.Join(words, " ")
+}
+
+// tokenize lowercases s and splits it into words of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Field weights for ranking, mirroring the A/B/C weights search_vector gives
+// title and author, genre, and description.
+const (
+	weightTitle       = 1.0
+	weightGenre       = 0.4
+	weightDescription = 0.2
+)
+
+// match reports whether term occurs in words, and where each occurrence
+// starts.
+func (term SearchTerm) match(words []string) []int {
+	var at []int
+	for i := 0; i+len(term.Words) <= len(words); i++ {
+		ok := true
+		for j, w := range term.Words {
+			last := j == len(term.Words)-1
+			if words[i+j] != w && !(last && term.Prefix && strings.HasPrefix(words[i+j], w)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			at = append(at, i)
+		}
+	}
+	return at
+}
+
+// searchBooks is the in-memory counterpart of the search_vector query: it
+// keeps the books matching every term and fills in their snippets. With
+// byRank they are reordered by weighted hit count, best first.
+func searchBooks(books []Book, q SearchQuery, byRank bool) []Book {
+	type scored struct {
+		book Book
+		rank float64
+	}
+	var results []scored
+	for _, b := range books {
+		title := tokenize(b.Title + " " + b.Author)
+		genre := tokenize(b.Genre)
+		description := tokenize(b.Description)
+
+		rank := 0.0
+		for _, term := range q.Terms {
+			hits := float64(len(term.match(title)))*weightTitle +
+				float64(len(term.match(genre)))*weightGenre +
+				float64(len(term.match(description)))*weightDescription
+			if hits == 0 {
+				rank = 0
+				break
+			}
+			rank += hits
+		}
+		if rank == 0 {
+			continue
+		}
+		b.Snippet = snippet(b.Description, q)
+		results = append(results, scored{b, rank})
+	}
+
+	if byRank {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].rank > results[j].rank
+		})
+	}
+	matched := make([]Book, len(results))
+	for i, r := range results {
+		matched[i] = r.book
+	}
+	return matched
+}
+
+// snippetWords is roughly how many words of context a snippet shows, as with
+// ts_headline's MaxWords.
+const snippetWords = 30
+
+// snippet returns an excerpt of text around the first match of q, HTML
+// escaped, with matching words wrapped in <mark>.
+func snippet(text string, q SearchQuery) string {
+	// Split on whitespace to keep the original spelling and punctuation,
+	// but match on the tokenised form of each word.
+	fields := strings.Fields(text)
+	tokens := make([]string, len(fields))
+	for i, f := range fields {
+		tokens[i] = strings.Join(tokenize(f), "")
+	}
+
+	marked := make([]bool, len(fields))
+	first := -1
+	for _, term := range q.Terms {
+		for _, at := range term.match(tokens) {
+			for i := at; i < at+len(term.Words); i++ {
+				marked[i] = true
+			}
+			if first < 0 || at < first {
+				first = at
+			}
+		}
+	}
+
+	start := 0
+	if first > snippetWords/3 {
+		start = first - snippetWords/3
+	}
+	end := min(start+snippetWords, len(fields))
+
+	var sb strings.Builder
+	for i := start; i < end; i++ {
+		if i > start {
+			sb.WriteByte(' ')
+		}
+		if marked[i] {
+			sb.WriteString("<mark>" + html.EscapeString(fields[i]) + "</mark>")
+		} else {
+			sb.WriteString(html.EscapeString(fields[i]))
+		}
+	}
+	return sb.String()
+}
+
+// sanitizeHeadline escapes a ts_headline result, which is built from user
+// text, keeping only the <mark> tags it was asked to insert.
+func sanitizeHeadline(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "&lt;mark&gt;", "<mark>")
+	return strings.ReplaceAll(s, "&lt;/mark&gt;", "</mark>")
+}
+
+// trigrams returns the set of pg_trgm style trigrams of a word: it is padded
+// with two spaces in front and one behind.
+func trigrams(word string) map[string]bool {
+	r := []rune("  " + word + " ")
+	set := make(map[string]bool, len(r))
+	for i := 0; i+3 <= len(r); i++ {
+		set[string(r[i:i+3])] = true
+	}
+	return set
+}
+
+// similarity is the share of trigrams two strings have in common, like
+// pg_trgm's similarity().
+func similarity(a, b string) float64 {
+	ta, tb := make(map[string]bool), make(map[string]bool)
+	for _, w := range tokenize(a) {
+		for t := range trigrams(w) {
+			ta[t] = true
+		}
+	}
+	for _, w := range tokenize(b) {
+		for t := range trigrams(w) {
+			tb[t] = true
+		}
+	}
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(q, text): the best
+// similarity between q and any run of as many consecutive words in text.
+func wordSimilarity(q, text string) float64 {
+	n := len(tokenize(q))
+	words := tokenize(text)
+	best := 0.0
+	for i := 0; i < len(words); i++ {
+		end := min(i+n, len(words))
+		best = max(best, similarity(q, strings.Join(words[i:end], " ")))
+	}
+	return best
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"dune", "dune"},
+		{"Frank Herbert", "frank & herbert"},
+		{`"left hand of darkness" le guin`, "(left <-> hand <-> of <-> darkness) & le & guin"},
+		{"tolk*", "tolk:*"},
+		{`"lord of the ri*"`, "(lord <-> of <-> the <-> ri:*)"},
+		{`"unterminated phrase`, "(unterminated <-> phrase)"},
+		{"it's & | ! <-> :*", "(it <-> s)"},
+		{"   ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseSearchQuery(tt.in).TSQuery(); got != tt.want {
+			t.Errorf("ParseSearchQuery(%q).TSQuery() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInMemorySearch(t *testing.T) {
+	s := NewInMemoryBookStore()
+	now := time.Now()
+	books := []Book{
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", Genre: "Fantasy", Description: "A hobbit is swept into a quest for dragon gold.", CreatedAt: now.Add(-3 * time.Hour)},
+		{Title: "Dragon Gold", Author: "Someone Else", Genre: "Fantasy", Description: "Not about hobbits.", CreatedAt: now.Add(-2 * time.Hour)},
+		{Title: "Dune", Author: "Frank Herbert", Genre: "Science Fiction", Description: "Politics <and> spice on a desert planet.", CreatedAt: now.Add(-time.Hour)},
+	}
+	for _, b := range books {
+		if _, err := s.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	titles := func(query, sort string) []string {
+		got, err := s.Search(BookFilter{Query: query, Sort: sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, b := range got.Results {
+			titles = append(titles, b.Title)
+		}
+		return titles
+	}
+
+	tests := []struct {
+		query, sort string
+		want        []string
+	}{
+		// Title matches outrank description matches
+		{"dragon gold", "", []string{"Dragon Gold", "The Hobbit"}},
+		{"dragon gold", "newest", []string{"Dragon Gold", "The Hobbit"}},
+		{"dragon gold", "oldest", []string{"The Hobbit", "Dragon Gold"}},
+		// No exact phrase match, so the fuzzy fallback finds the title
+		{`"gold dragon"`, "", []string{"Dragon Gold"}},
+		{"tolk*", "", []string{"The Hobbit"}},
+		{"hobbit*", "", []string{"The Hobbit", "Dragon Gold"}},
+		{"science", "", []string{"Dune"}},
+	}
+	for _, tt := range tests {
+		if got := titles(tt.query, tt.sort); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q sort %q = %v, want %v", tt.query, tt.sort, got, tt.want)
+		}
+	}
+
+	got, err := s.Search(BookFilter{Query: "spice"})
+	if err != nil || len(got.Results) != 1 {
+		t.Fatalf("search spice = %v, %v, want one book", got.Results, err)
+	}
+	if want := "Politics &lt;and&gt; <mark>spice</mark> on a desert planet."; got.Results[0].Snippet != want {
+		t.Errorf("snippet = %q, want %q", got.Results[0].Snippet, want)
+	}
+}
+
+func TestWordSimilarity(t *testing.T) {
+	if got := similarity("tolkein", "tolkien"); got < 0.33 || got > 0.34 {
+		t.Errorf("similarity(tolkein, tolkien) = %v, want 1/3 as in pg_trgm", got)
+	}
+	if got := wordSimilarity("tolkein", "J. R. R. Tolkien"); got < fuzzyThreshold {
+		t.Errorf("wordSimilarity(tolkein, J. R. R. Tolkien) = %v, want at least %v", got, fuzzyThreshold)
+	}
+	if got := wordSimilarity("tolkein", "Frank Herbert"); got >= fuzzyThreshold {
+		t.Errorf("wordSimilarity(tolkein, Frank Herbert) = %v, want below %v", got, fuzzyThreshold)
+	}
+}
+
+func TestInMemoryFuzzySearchAndSuggest(t *testing.T) {
+	s := NewInMemoryBookStore()
+	for _, b := range []Book{
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien"},
+		{Title: "The Silmarillion", Author: "J. R. R. Tolkien"},
+		{Title: "Hobbies for Beginners", Author: "Ann Other"},
+		{Title: "Dune", Author: "Frank Herbert", Availability: AvailabilityWithdrawn},
+	} {
+		if _, err := s.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := s.Search(BookFilter{Query: "tolkein"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 2 || !result.Fuzzy {
+		t.Errorf("fuzzy search for tolkein found %d books, fuzzy %v, want 2 fuzzy matches", len(result.Results), result.Fuzzy)
+	}
+
+	suggestions, err := s.Suggest("hobb", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Suggestion{{"Hobbies for Beginners", "title"}, {"The Hobbit", "title"}}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("Suggest(hobb) = %v, want %v", suggestions, want)
+	}
+
+	if suggestions, _ := s.Suggest("dune", 5); len(suggestions) != 0 {
+		t.Errorf("Suggest(dune) = %v, want withdrawn books left out", suggestions)
+	}
+}
+
+func TestInMemoryFuzzySearchPaging(t *testing.T) {
+	s := NewInMemoryBookStore()
+	now := time.Now()
+	for i, title := range []string{"The Hobbit", "The Silmarillion", "Unfinished Tales"} {
+		if _, err := s.Add(Book{Title: title, Author: "J. R. R. Tolkien", CreatedAt: now.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []string{"", "newest"} {
+		var titles []string
+		page := Page{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("sort %q: paging didn't end", sort)
+			}
+			result, err := s.Search(BookFilter{Query: "tolkein", Sort: sort, Page: page})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Fuzzy || result.Total != 3 {
+				t.Errorf("sort %q page %d: fuzzy %v, total %d, want fuzzy with 3", sort, pages+1, result.Fuzzy, result.Total)
+			}
+			for _, b := range result.Results {
+				titles = append(titles, b.Title)
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			if page.After, err = DecodeCursor(result.NextCursor); err != nil {
+				t.Fatal(err)
+			}
+			if !page.After.Fuzzy {
+				t.Errorf("sort %q: next cursor isn't marked fuzzy", sort)
+			}
+		}
+		if len(titles) != 3 {
+			t.Errorf("sort %q: paged through %v, want all 3 books", sort, titles)
+		}
+	}
+}
+
+func TestInMemorySearchFacets(t *testing.T) {
+	s := NewInMemoryBookStore()
+	for _, b := range []Book{
+		{Title: "The Hobbit", Genre: "Fantasy", UserLocation: "Leeds", Condition: ConditionGood, Format: FormatHardcover},
+		{Title: "Earthsea", Genre: "Fantasy", UserLocation: "York", Condition: ConditionFair, Format: FormatPaperback},
+		{Title: "Dune", Genre: "Science Fiction", UserLocation: "Leeds", Condition: ConditionGood, Format: FormatPaperback},
+		{Title: "Emma", Genre: "Classics", UserLocation: "Leeds", Availability: AvailabilityReserved},
+	} {
+		if _, err := s.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := s.Search(BookFilter{Genre: "Fantasy", Page: Page{Limit: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 1 || result.Total != 2 {
+		t.Errorf("got %d results of %d, want 1 of 2", len(result.Results), result.Total)
+	}
+
+	// Each facet ignores its own filter but applies the others
+	wantGenre := []FacetCount{{"Fantasy", 2}, {"Science Fiction", 1}}
+	if !reflect.DeepEqual(result.Facets.Genre, wantGenre) {
+		t.Errorf("genre facet = %v, want %v", result.Facets.Genre, wantGenre)
+	}
+	wantLocation := []FacetCount{{"Leeds", 1}, {"York", 1}}
+	if !reflect.DeepEqual(result.Facets.Location, wantLocation) {
+		t.Errorf("location facet = %v, want %v", result.Facets.Location, wantLocation)
+	}
+	wantAvailability := []FacetCount{{"available", 2}}
+	if !reflect.DeepEqual(result.Facets.Availability, wantAvailability) {
+		t.Errorf("availability facet = %v, want %v", result.Facets.Availability, wantAvailability)
+	}
+	wantCondition := []FacetCount{{"fair", 1}, {"good", 1}}
+	if !reflect.DeepEqual(result.Facets.Condition, wantCondition) {
+		t.Errorf("condition facet = %v, want %v", result.Facets.Condition, wantCondition)
+	}
+
+	result, err = s.Search(BookFilter{Condition: ConditionGood, Format: FormatPaperback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 1 || result.Results[0].Title != "Dune" {
+		t.Errorf("good paperbacks = %v, want just Dune", result.Results)
+	}
+	wantFormat := []FacetCount{{"hardcover", 1}, {"paperback", 1}}
+	if !reflect.DeepEqual(result.Facets.Format, wantFormat) {
+		t.Errorf("format facet = %v, want %v", result.Facets.Format, wantFormat)
+	}
+}
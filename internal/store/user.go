@@ -3,8 +3,28 @@ package store
 import (
 	"database/sql"
 	"time"
+
+	"testbook-backend/internal/apperr"
+
+	"github.com/lib/pq"
 )
 
+// ErrUserNotFound and ErrResetTokenNotFound wrap sql.ErrNoRows so existing
+// checks for it keep working.
+var (
+	ErrUserNotFound       = apperr.NotFound("User not found").Wrap(sql.ErrNoRows)
+	ErrResetTokenNotFound = apperr.NotFound("Invalid or expired token").Wrap(sql.ErrNoRows)
+	ErrEmailTaken         = apperr.Conflict("An account with this email already exists")
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint violation.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation
+}
+
 type User struct {
 	ID         int       `json:"id"`
 	ClerkID    string    `json:"clerk_id,omitempty"`
@@ -15,18 +35,24 @@ type User struct {
 	AvatarPath string    `json:"avatar_path,omitempty"`
 	Location   string    `json:"location,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Version    int       `json:"version"`
 }
 
 type UserStore interface {
 	Create(user User) error
 	GetByEmail(email string) (User, error)
 	GetByID(id int) (User, error)
+	GetByClerkID(clerkID string) (User, error)
+	UpsertByClerkID(user User) (User, error)
+	DeleteByClerkID(clerkID string) error
 	Update(user User) error
+	Patch(id int, patch UserPatch, version int) (User, error)
 	SaveResetToken(token string, userID int, expiry time.Time) error
 	GetResetToken(token string) (int, time.Time, error)
 	DeleteResetToken(token string) error
 	UpdatePassword(userID int, password string) error
-	GetMembers(searchQuery string) ([]User, error)
+	GetMembers(searchQuery string, page Page) (Paged[User], error)
 }
 
 type PostgresUserStore struct {
@@ -39,51 +65,26 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 	}
 }
 
-func (s *PostgresUserStore) Migrate() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
-		);
-		ALTER TABLE users ADD COLUMN IF NOT EXISTS username TEXT;
-		ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT;
-		ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_path TEXT;
-		ALTER TABLE users ADD COLUMN IF NOT EXISTS location TEXT;
-		ALTER TABLE users ADD COLUMN IF NOT EXISTS clerk_id TEXT UNIQUE;
-
-		CREATE TABLE IF NOT EXISTS password_resets (
-			token TEXT PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			expiry TIMESTAMP NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS book_requests (
-			id SERIAL PRIMARY KEY,
-			book_id INTEGER REFERENCES books(id),
-			requester_id INTEGER REFERENCES users(id),
-			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(book_id, requester_id)
-		);
-		`
-	_, err := s.db.Exec(query)
-	return err
-}
-
 func (s *PostgresUserStore) Create(user User) error {
 	query := `
 		INSERT INTO users (email, password, username, avatar_path, clerk_id)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at`
 
-	return s.db.QueryRow(query, user.Email, user.Password, user.Username, user.AvatarPath, user.ClerkID).Scan(&user.ID, &user.CreatedAt)
+	err := s.db.QueryRow(query, user.Email, user.Password, user.Username, user.AvatarPath, user.ClerkID).Scan(&user.ID, &user.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken.Wrap(err)
+	}
+	return err
 }
 
 func (s *PostgresUserStore) GetByEmail(email string) (User, error) {
-	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, COALESCE(clerk_id, '') FROM users WHERE email = $1`
+	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, updated_at, version, COALESCE(clerk_id, '') FROM users WHERE email = $1`
 	var user User
-	err := s.db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.ClerkID)
+	err := s.db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.ClerkID)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
 	if err != nil {
 		return User{}, err
 	}
@@ -91,9 +92,12 @@ func (s *PostgresUserStore) GetByEmail(email string) (User, error) {
 }
 
 func (s *PostgresUserStore) GetByID(id int) (User, error) {
-	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, COALESCE(clerk_id, '') FROM users WHERE id = $1`
+	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, updated_at, version, COALESCE(clerk_id, '') FROM users WHERE id = $1`
 	var user User
-	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.ClerkID)
+	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.ClerkID)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
 	if err != nil {
 		return User{}, err
 	}
@@ -1,35 +1,75 @@
 package store
 
+import "database/sql"
+
 func (s *PostgresUserStore) GetByClerkID(clerkID string) (User, error) {
-	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, COALESCE(clerk_id, '') FROM users WHERE clerk_id = $1`
+	query := `SELECT id, email, password, COALESCE(username, ''), COALESCE(bio, ''), COALESCE(avatar_path, ''), COALESCE(location, ''), created_at, updated_at, version, COALESCE(clerk_id, '') FROM users WHERE clerk_id = $1`
 	var user User
-	err := s.db.QueryRow(query, clerkID).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.ClerkID)
+	err := s.db.QueryRow(query, clerkID).Scan(&user.ID, &user.Email, &user.Password, &user.Username, &user.Bio, &user.AvatarPath, &user.Location, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.ClerkID)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
+// UpsertByClerkID syncs the Clerk-managed fields of a user (email, username,
+// avatar). Existing rows are matched on clerk_id first and then on email, so
+// accounts created before Clerk IDs were recorded get linked rather than
+// duplicated. Bio and location are left alone.
+func (s *PostgresUserStore) UpsertByClerkID(user User) (User, error) {
+	var id int
+	err := s.db.QueryRow(`
+		UPDATE users SET email = $1, username = $2, avatar_path = $3, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE clerk_id = $4
+		RETURNING id`,
+		user.Email, user.Username, user.AvatarPath, user.ClerkID).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = s.db.QueryRow(`
+			INSERT INTO users (email, password, username, avatar_path, clerk_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (email) DO UPDATE
+			SET username = EXCLUDED.username, avatar_path = EXCLUDED.avatar_path, clerk_id = EXCLUDED.clerk_id,
+				version = users.version + 1, updated_at = CURRENT_TIMESTAMP
+			RETURNING id`,
+			user.Email, "clerk_managed_account", user.Username, user.AvatarPath, user.ClerkID).Scan(&id)
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return s.GetByID(id)
+}
+
+// DeleteByClerkID removes a user together with their books, the requests
+// they made or received (and the conversations on them) and any pending
+// password resets.
 func (s *PostgresUserStore) DeleteByClerkID(clerkID string) error {
-	// First get the user ID to delete related books (if cascade isn't set up)
 	user, err := s.GetByClerkID(clerkID)
 	if err != nil {
 		return err
 	}
 
-	// Manual cascade for books (just in case)
-	_, err = s.db.Exec(`DELETE FROM books WHERE user_id = $1`, user.ID)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Manual cascade for book_requests
-	_, err = s.db.Exec(`DELETE FROM book_requests WHERE requester_id = $1`, user.ID)
-	if err != nil {
-		return err
+	// Conversations and messages cascade from book_requests
+	statements := []string{
+		`DELETE FROM book_requests WHERE requester_id = $1 OR book_id IN (SELECT id FROM books WHERE user_id = $1)`,
+		`DELETE FROM messages WHERE sender_id = $1`,
+		`DELETE FROM books WHERE user_id = $1`,
+		`DELETE FROM password_resets WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+	for _, query := range statements {
+		if _, err := tx.Exec(query, user.ID); err != nil {
+			return err
+		}
 	}
 
-	query := `DELETE FROM users WHERE clerk_id = $1`
-	_, err = s.db.Exec(query, clerkID)
-	return err
+	return tx.Commit()
 }
@@ -0,0 +1,42 @@
+package store
+
+// UserPatch lists the profile fields of a user to change. Nil fields are
+// left as they are.
+type UserPatch struct {
+	Username   *string
+	Bio        *string
+	Location   *string
+	AvatarPath *string
+}
+
+// Apply returns user with the patch's fields written over it.
+func (p UserPatch) Apply(user User) User {
+	setIf(&user.Username, p.Username)
+	setIf(&user.Bio, p.Bio)
+	setIf(&user.Location, p.Location)
+	setIf(&user.AvatarPath, p.AvatarPath)
+	return user
+}
+
+// Patch updates only the fields set in patch. If version is above zero the
+// update only goes through while the user is still at that version.
+func (s *PostgresUserStore) Patch(id int, patch UserPatch, version int) (User, error) {
+	update := patchUpdate{table: "users"}
+	if patch.Username != nil {
+		update.set("username", *patch.Username)
+	}
+	if patch.Bio != nil {
+		update.set("bio", *patch.Bio)
+	}
+	if patch.Location != nil {
+		update.set("location", *patch.Location)
+	}
+	if patch.AvatarPath != nil {
+		update.set("avatar_path", *patch.AvatarPath)
+	}
+
+	if err := update.exec(s.db, id, version, ErrUserNotFound); err != nil {
+		return User{}, err
+	}
+	return s.GetByID(id)
+}
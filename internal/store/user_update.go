@@ -1,7 +1,7 @@
 package store
 
 func (s *PostgresUserStore) Update(user User) error {
-	query := `UPDATE users SET username = $1, bio = $2, avatar_path = $3, location = $4, clerk_id = $5 WHERE id = $6`
+	query := `UPDATE users SET username = $1, bio = $2, avatar_path = $3, location = $4, clerk_id = $5, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = $6`
 	_, err := s.db.Exec(query, user.Username, user.Bio, user.AvatarPath, user.Location, user.ClerkID, user.ID)
 	return err
 }
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"testbook-backend/internal/apperr"
+
+	"github.com/lib/pq"
+)
+
+var ErrWorkNotFound = apperr.NotFound("Work not found")
+
+// Work is a book in the abstract, which members' listings are copies of.
+// Copies are grouped by ISBN or, failing that, by title and author spelt
+// the same way give or take case, punctuation and name order.
+type Work struct {
+	ID             int      `json:"id"`
+	Title          string   `json:"title"`
+	Author         string   `json:"author"`
+	ISBN13         string   `json:"isbn13,omitempty"`
+	CoverPath      string   `json:"cover_path,omitempty"` // One of the copies' images
+	Editions       []string `json:"editions"`             // Distinct ISBN-13s of the copies
+	CopyCount      int      `json:"copy_count"`           // Copies that haven't been withdrawn
+	AvailableCount int      `json:"available_count"`
+}
+
+// workKey mirrors the work_key SQL function that works are matched on.
+func workKey(title, author string) string {
+	t := tokenize(title)
+	if len(t) > 1 && (t[0] == "the" || t[0] == "a" || t[0] == "an") {
+		t = t[1:]
+	}
+	a := tokenize(author)
+	sort.Strings(a)
+	return strings.Join(t, " ") + "|" + strings.Join(a, " ")
+}
+
+// resolveWork returns the work a copy belongs to: the work with its ISBN if
+// there is one, otherwise the work its title and author match, which is
+// created if this is the first copy.
+func resolveWork(q queryer, title, author, isbn string) (int, error) {
+	var id int
+	if isbn != "" {
+		err := q.QueryRow(`SELECT id FROM works WHERE isbn13 = $1 ORDER BY id LIMIT 1`, isbn).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+	err := q.QueryRow(`
+		INSERT INTO works (title, author, isbn13, match_key)
+		VALUES ($1, $2, NULLIF($3, ''), work_key($1, $2))
+		ON CONFLICT (match_key) DO UPDATE SET isbn13 = COALESCE(works.isbn13, EXCLUDED.isbn13)
+		RETURNING id`, title, author, isbn).Scan(&id)
+	return id, err
+}
+
+// relinkWork moves book id to the work its current title, author and ISBN
+// belong to, after an edit that may have changed them.
+func relinkWork(q queryer, id int) error {
+	var title, author, isbn string
+	err := q.QueryRow(`SELECT title, author, COALESCE(isbn13, '') FROM books WHERE id = $1`, id).Scan(&title, &author, &isbn)
+	if err == sql.ErrNoRows {
+		return ErrBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	workID, err := resolveWork(q, title, author, isbn)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE books SET work_id = $1 WHERE id = $2 AND work_id IS DISTINCT FROM $1`, workID, id)
+	return err
+}
+
+func (s *PostgresBookStore) GetWork(id int) (Work, error) {
+	query := `
+		SELECT w.id, w.title, w.author, COALESCE(w.isbn13, ''),
+			COALESCE((
+				SELECT c.image_path FROM books c
+				WHERE c.work_id = w.id AND COALESCE(c.image_path, '') != ''
+				ORDER BY c.availability = 'available' DESC, c.created_at DESC
+				LIMIT 1
+			), ''),
+			COALESCE(array_agg(DISTINCT b.isbn13) FILTER (WHERE b.isbn13 IS NOT NULL), '{}'),
+			COUNT(b.id) FILTER (WHERE b.availability != 'withdrawn'),
+			COUNT(b.id) FILTER (WHERE b.availability = 'available')
+		FROM works w
+		LEFT JOIN books b ON b.work_id = w.id
+		WHERE w.id = $1
+		GROUP BY w.id`
+
+	var w Work
+	err := s.db.QueryRow(query, id).Scan(&w.ID, &w.Title, &w.Author, &w.ISBN13, &w.CoverPath, pq.Array(&w.Editions), &w.CopyCount, &w.AvailableCount)
+	if err == sql.ErrNoRows {
+		return Work{}, ErrWorkNotFound
+	}
+	if err != nil {
+		return Work{}, err
+	}
+	if w.Editions == nil {
+		w.Editions = []string{}
+	}
+	return w, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import "testing"
+
+func TestWorkGrouping(t *testing.T) {
+	s := NewInMemoryBookStore()
+	add := func(b Book) Book {
+		t.Helper()
+		b, err := s.Add(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	dune := add(Book{Title: "Dune", Author: "Frank Herbert", ImagePath: "/uploads/1.jpg"})
+	respelt := add(Book{Title: "DUNE.", Author: "Herbert, Frank", Availability: AvailabilityReserved})
+	withISBN := add(Book{Title: "The Dune", Author: "Frank  Herbert", ISBN13: "9780441013593"})
+	// Spelt differently again, but the ISBN the last copy gave Dune matches
+	byISBN := add(Book{Title: "Dune (40th Anniversary)", Author: "F. Herbert", ISBN13: "9780441013593"})
+	other := add(Book{Title: "Dune Messiah", Author: "Frank Herbert"})
+
+	for _, b := range []Book{respelt, withISBN, byISBN} {
+		if b.WorkID != dune.WorkID {
+			t.Errorf("%q by %q is work %d, want %d", b.Title, b.Author, b.WorkID, dune.WorkID)
+		}
+	}
+	if other.WorkID == dune.WorkID {
+		t.Errorf("Dune Messiah was grouped with Dune")
+	}
+
+	work, err := s.GetWork(dune.WorkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.CopyCount != 4 || work.AvailableCount != 3 || work.ISBN13 != "9780441013593" || work.CoverPath != "/uploads/1.jpg" {
+		t.Errorf("GetWork = %+v", work)
+	}
+
+	copies, err := s.Search(BookFilter{WorkID: dune.WorkID, Availability: AvailabilityAny})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copies.Total != 4 {
+		t.Errorf("work has %d copies, want 4", copies.Total)
+	}
+
+	if _, err := s.GetWork(99); err != ErrWorkNotFound {
+		t.Errorf("GetWork(99) error = %v, want ErrWorkNotFound", err)
+	}
+}
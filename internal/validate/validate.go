@@ -0,0 +1,80 @@
+// Package validate collects field-level input errors so handlers can report
+// every problem with a request at once.
+package validate
+
+import (
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"testbook-backend/internal/apperr"
+)
+
+// Validator accumulates the first failure for each field. The zero value is
+// ready to use.
+type Validator struct {
+	fields map[string]string
+}
+
+// New returns an empty Validator.
+func New() *Validator {
+	return &Validator{}
+}
+
+// Check records message against field unless ok holds. Only the first
+// failure per field is kept.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok {
+		return
+	}
+	if v.fields == nil {
+		v.fields = make(map[string]string)
+	}
+	if _, exists := v.fields[field]; !exists {
+		v.fields[field] = message
+	}
+}
+
+// Required fails if value is empty or only whitespace.
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLength fails if value is longer than max characters.
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, "must be at most "+strconv.Itoa(max)+" characters")
+}
+
+// MinLength fails if value is non-empty and shorter than min characters.
+func (v *Validator) MinLength(field, value string, min int) {
+	v.Check(value == "" || utf8.RuneCountInString(value) >= min, field, "must be at least "+strconv.Itoa(min)+" characters")
+}
+
+// OneOf fails if value is non-empty and not in allowed.
+func (v *Validator) OneOf(field, value string, allowed []string) {
+	v.Check(value == "" || slices.Contains(allowed, value), field, "is not an allowed value")
+}
+
+// Email fails if value is non-empty and not a bare email address.
+func (v *Validator) Email(field, value string) {
+	if value == "" {
+		return
+	}
+	addr, err := mail.ParseAddress(value)
+	v.Check(err == nil && addr.Address == value, field, "must be a valid email address")
+}
+
+// Valid reports whether no checks have failed.
+func (v *Validator) Valid() bool {
+	return len(v.fields) == 0
+}
+
+// Err returns an apperr validation error listing every failed field, or nil.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return apperr.Validation(v.fields)
+}
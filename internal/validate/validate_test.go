@@ -0,0 +1,49 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"testbook-backend/internal/apperr"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	v.Required("title", "   ")
+	v.MaxLength("title", strings.Repeat("x", 300), 200)
+	v.MaxLength("author", "Ursula K. Le Guin", 200)
+	v.OneOf("genre", "Cookbooks", []string{"Fantasy", "Science Fiction"})
+	v.OneOf("language", "", []string{"en"})
+	v.Email("email", "Gopher <gopher@example.com>")
+	v.MinLength("username", "ab", 3)
+
+	e := apperr.As(v.Err())
+	if e == nil || e.Code != apperr.CodeValidation {
+		t.Fatalf("Err() = %v, want a validation error", v.Err())
+	}
+
+	want := map[string]string{
+		"title":    "is required",
+		"genre":    "is not an allowed value",
+		"email":    "must be a valid email address",
+		"username": "must be at least 3 characters",
+	}
+	if len(e.Fields) != len(want) {
+		t.Errorf("got fields %v, want %v", e.Fields, want)
+	}
+	for field, msg := range want {
+		if e.Fields[field] != msg {
+			t.Errorf("%s: got %q, want %q", field, e.Fields[field], msg)
+		}
+	}
+}
+
+func TestValidatorValid(t *testing.T) {
+	v := New()
+	v.Required("title", "Dune")
+	v.MaxLength("title", "Dune", 200)
+	v.Email("email", "gopher@example.com")
+	if err := v.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
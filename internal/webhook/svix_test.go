@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSvixVerifier(t *testing.T) {
+	secret := "whsec_" + base64.StdEncoding.EncodeToString([]byte("test-signing-secret"))
+	v, err := NewSvixVerifier(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+
+	body := []byte(`{"type":"user.created"}`)
+	signed := func(ts time.Time, payload []byte) http.Header {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		sig := base64.StdEncoding.EncodeToString(v.sign("msg_1", timestamp, payload))
+		h := http.Header{}
+		h.Set("svix-id", "msg_1")
+		h.Set("svix-timestamp", timestamp)
+		h.Set("svix-signature", "v1,bm90LXRoZS1zaWc= v1,"+sig)
+		return h
+	}
+
+	if err := v.Verify(signed(now, body), body); err != nil {
+		t.Errorf("valid delivery rejected: %v", err)
+	}
+	if err := v.Verify(signed(now, body), []byte(`{"type":"user.deleted"}`)); err != ErrInvalidSignature {
+		t.Errorf("tampered body: got %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := v.Verify(signed(now.Add(-10*time.Minute), body), body); err != ErrStaleTimestamp {
+		t.Errorf("old delivery: got %v, want %v", err, ErrStaleTimestamp)
+	}
+	if err := v.Verify(http.Header{}, body); err != ErrMissingHeaders {
+		t.Errorf("unsigned delivery: got %v, want %v", err, ErrMissingHeaders)
+	}
+}